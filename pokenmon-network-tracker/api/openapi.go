@@ -0,0 +1,12 @@
+// Package api embeds the OpenAPI document so the server validates against the same file it publishes.
+//
+// The document lives at the repository root; go:embed cannot reach outside the
+// module, so openapi.yml here is a copy kept in step by go generate.
+package api
+
+import _ "embed"
+
+//go:generate cp ../../openapi.yml openapi.yml
+
+//go:embed openapi.yml
+var Spec []byte
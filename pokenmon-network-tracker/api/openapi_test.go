@@ -0,0 +1,20 @@
+package api
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSpecMatchesRepositoryDocument(t *testing.T) {
+	doc, err := os.ReadFile("../../openapi.yml")
+	if os.IsNotExist(err) {
+		t.Skip("built outside the repository")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(doc, Spec) {
+		t.Error("api/openapi.yml is out of date with the repository's openapi.yml, run go generate ./api")
+	}
+}
@@ -0,0 +1,67 @@
+// Command agent-worker runs rocket agents. It registers with the API over the
+// broker, takes spawn and stop commands from it and reports its agents' events back.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/config"
+	"syscall"
+)
+
+func main() {
+	cfg, err := config.Load("agent-worker", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	if cfg.Worker.Id == "" {
+		host, _ := os.Hostname()
+		cfg.Worker.Id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	log.Printf("Configuration:\n%s", cfg.Redacted())
+
+	conn, err := event.RabbitMQConnect(cfg.Broker.URL)
+	if err != nil {
+		log.Panic(err)
+	}
+	topo := event.TopologyOf(cfg.Broker)
+
+	bus, err := event.NewBusBroadcaster(conn, topo)
+	if err != nil {
+		log.Panic(err)
+	}
+	worker := event.NewWorker(conn, topo, event.AgentOptions{
+		MinTaskTime: cfg.Agent.MinTaskTime,
+		MaxTaskTime: cfg.Agent.MaxTaskTime,
+		FailureRate: cfg.Agent.FailureRate,
+
+		HeartbeatInterval: cfg.Agent.HeartbeatInterval,
+	}, cfg.Worker.Id, cfg.Worker.Capacity, bus)
+	if err := worker.Start(); err != nil {
+		log.Panic(err)
+	}
+	log.Printf("Agent worker %s ready for %d agents", worker.Id, cfg.Worker.Capacity)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	// agents still busy at the deadline hand their task back to the queue
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := worker.Shutdown(ctx); err != nil {
+		log.Println("worker:", err)
+	}
+	bus.Close()
+	conn.Close()
+	log.Println("Shutdown complete")
+}
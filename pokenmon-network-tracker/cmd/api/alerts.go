@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/alert"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"slices"
+	"time"
+)
+
+// evaluateAlerts runs the alert rules against each new history sample. Alerts
+// that fire or resolve go to the broadcaster, and so to the hub and the
+// webhook subscriptions, and to every alerts.webhooks URL.
+func (app *Config) evaluateAlerts() {
+	b := broadcast.NewMulti()
+	b.Add("broadcaster", app.broadcaster)
+	for i, url := range app.cfg.Alerts.Webhooks {
+		sink := broadcast.NewWebhookSink(url, 5*time.Second)
+		b.Add(fmt.Sprintf("alert webhook %d (%s)", i+1, sink.Host()), sink)
+	}
+
+	ticker := time.NewTicker(app.cfg.History.Interval)
+	defer ticker.Stop()
+	var last time.Time
+	for range ticker.C {
+		sample, ok := app.history.Latest()
+		if !ok || !sample.Time.After(last) {
+			continue
+		}
+		last = sample.Time
+		app.alerts.Evaluate(sample, b)
+	}
+}
+
+// GetAlerts lists every alert rule with its state, only those in ?state= when given.
+func (app *Config) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts := app.alerts.Alerts()
+	if state := r.URL.Query().Get("state"); state != "" {
+		alerts = slices.DeleteFunc(alerts, func(a alert.Alert) bool { return a.State != state })
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(alerts)
+	w.Write(out)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/auth"
+	"strings"
+)
+
+// setupAuth loads the credentials in the auth settings, which come from the
+// config file, AUTH_API_KEYS and AUTH_JWT_SECRET or the matching flags:
+//
+//	auth.apiKeys: [role:key[:team], ...]  static API keys, e.g. "admin:s3cret" or "sighting-reporter:abc:team-red"
+//	auth.jwtSecret: ...                   secret for locally verified HS256 JWTs (claims: sub, role, team, exp)
+//
+// When neither is set every request is rejected, unless auth.disabled opts into
+// serving every route as an anonymous admin, which is only meant for local development.
+func (app *Config) setupAuth() error {
+	a := auth.NewAuthenticator(app.cfg.Auth.JWTSecret)
+
+	for i, entry := range app.cfg.Auth.APIKeys {
+		parts := strings.Split(entry, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[1] == "" {
+			return fmt.Errorf("invalid auth.apiKeys entry %d, expected role:key[:team]", i+1)
+		}
+		role, err := auth.ParseRole(parts[0])
+		if err != nil {
+			return err
+		}
+		p := auth.Principal{Subject: fmt.Sprintf("%s-key-%d", role, i+1), Role: role}
+		if len(parts) == 3 {
+			p.Team = parts[2]
+		}
+		a.AddKey(parts[1], p)
+	}
+
+	switch {
+	case app.cfg.Auth.Disabled:
+		log.Println("WARNING: auth.disabled is set, every route is open")
+	case !a.Enabled():
+		log.Println("WARNING: no auth.apiKeys or auth.jwtSecret set, every request will be rejected")
+	}
+	app.auth = a
+	return nil
+}
+
+// authenticate resolves the caller and stores it in the request context.
+// The access_token query parameter is only honoured on the event stream routes.
+func (app *Config) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.cfg.Auth.Disabled {
+			p := auth.Principal{Subject: "anonymous", Role: auth.Admin}
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+			return
+		}
+
+		allowQuery := strings.HasPrefix(r.URL.Path, "/state/events") || strings.HasPrefix(r.URL.Path, "/v1/events")
+		p, err := app.auth.Authenticate(r, allowQuery)
+		if err != nil {
+			if errors.Is(err, auth.ErrNoCredentials) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="ptn"`)
+			}
+			writeError(w, r, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+	})
+}
+
+// requireRole only lets callers holding one of roles (or admin) through.
+func requireRole(roles ...auth.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, ok := auth.FromContext(r.Context())
+			if !ok {
+				writeError(w, r, http.StatusUnauthorized, codeUnauthorized, auth.ErrNoCredentials.Error())
+				return
+			}
+			if !p.Allowed(roles...) {
+				writeError(w, r, http.StatusForbidden, codeForbidden, fmt.Sprintf("role %q is not allowed to access this route", p.Role))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
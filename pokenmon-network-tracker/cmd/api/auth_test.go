@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/config"
+	"pokemonSightingApp/cmd/internal/trackerpb"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func authApp(t *testing.T, configure func(*config.Auth)) *Config {
+	t.Helper()
+	app := &Config{cfg: config.Default()}
+	configure(&app.cfg.Auth)
+	if err := app.setupAuth(); err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		configure func(*config.Auth)
+		key       string
+		want      int
+		role      auth.Role
+	}{
+		{"no credentials configured", func(*config.Auth) {}, "", http.StatusUnauthorized, ""},
+		{"no credentials configured, key sent", func(*config.Auth) {}, "anything", http.StatusUnauthorized, ""},
+		{"disabled", func(a *config.Auth) { a.Disabled = true }, "", http.StatusOK, auth.Admin},
+		{"missing key", func(a *config.Auth) { a.APIKeys = []string{"sighting-reporter:abc"} }, "", http.StatusUnauthorized, ""},
+		{"wrong key", func(a *config.Auth) { a.APIKeys = []string{"sighting-reporter:abc"} }, "abd", http.StatusUnauthorized, ""},
+		{"valid key", func(a *config.Auth) { a.APIKeys = []string{"sighting-reporter:abc"} }, "abc", http.StatusOK, auth.SightingReporter},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			app := authApp(t, tc.configure)
+			var got auth.Principal
+			h := app.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = auth.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/v1/stats", nil)
+			if tc.key != "" {
+				req.Header.Set("X-API-Key", tc.key)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if got.Role != tc.role {
+				t.Errorf("role = %q, want %q", got.Role, tc.role)
+			}
+		})
+	}
+}
+
+func TestGRPCAuthorizeFailsClosed(t *testing.T) {
+	app := authApp(t, func(*config.Auth) {})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-api-key", "anything"))
+	if _, err := app.grpcAuthorize(ctx, trackerpb.Tracker_ReportSighting_FullMethodName); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("err = %v, want Unauthenticated", err)
+	}
+
+	app = authApp(t, func(a *config.Auth) { a.Disabled = true })
+	ctx, err := app.grpcAuthorize(context.Background(), trackerpb.Tracker_ReportSighting_FullMethodName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := auth.FromContext(ctx); p.Role != auth.Admin {
+		t.Errorf("role = %q, want admin", p.Role)
+	}
+}
+
+func TestAllowOrigin(t *testing.T) {
+	app := &Config{cfg: config.Default()}
+	req := httptest.NewRequest(http.MethodGet, "/v1/stats", nil)
+	if app.allowOrigin(req, "http://evil.example") {
+		t.Error("an empty corsOrigins allowed a cross-origin request")
+	}
+
+	app.cfg.HTTP.CORSOrigins = []string{"http://localhost:8080"}
+	if !app.allowOrigin(req, "http://localhost:8080") || app.allowOrigin(req, "http://evil.example") {
+		t.Error("corsOrigins not applied")
+	}
+
+	app.cfg.HTTP.CORSOrigins = []string{"*"}
+	if !app.allowOrigin(req, "http://evil.example") {
+		t.Error(`"*" did not allow every origin`)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// slowConsumerPolicy decides what the hub does when a client's send buffer is full.
+type slowConsumerPolicy string
+
+const (
+	// dropOldest discards the oldest queued event to make room for the new one.
+	dropOldest slowConsumerPolicy = "drop-oldest"
+	// dropNewest discards the new event and keeps the queue as is.
+	dropNewest slowConsumerPolicy = "drop-newest"
+	// disconnect closes the client with a reason.
+	disconnect slowConsumerPolicy = "disconnect"
+)
+
+const (
+	defaultSendBuffer = 1024
+	maxSendBuffer     = 8192
+)
+
+// parseBackpressure reads the "policy" and "buffer" query parameters.
+func parseBackpressure(r *http.Request) (slowConsumerPolicy, int, error) {
+	q := r.URL.Query()
+
+	buffer := 0
+	if v := q.Get("buffer"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return "", 0, fmt.Errorf("buffer must be between 1 and %d", maxSendBuffer)
+		}
+		buffer = n
+	}
+	return backpressure(slowConsumerPolicy(q.Get("policy")), buffer)
+}
+
+// backpressure validates a client's policy and buffer, defaulting to
+// disconnect and defaultSendBuffer when they are unset.
+func backpressure(policy slowConsumerPolicy, buffer int) (slowConsumerPolicy, int, error) {
+	switch policy {
+	case "":
+		policy = disconnect
+	case dropOldest, dropNewest, disconnect:
+	default:
+		return "", 0, fmt.Errorf("unknown policy %q, expected one of %s, %s, %s", policy, dropOldest, dropNewest, disconnect)
+	}
+
+	if buffer == 0 {
+		buffer = defaultSendBuffer
+	}
+	if buffer < 1 || buffer > maxSendBuffer {
+		return "", 0, fmt.Errorf("buffer must be between 1 and %d", maxSendBuffer)
+	}
+	return policy, buffer, nil
+}
+
+// newClient builds a hub client from the request's filter, resume and backpressure parameters.
+func newClient(r *http.Request, kind string) (*Client, error) {
+	policy, buffer, err := parseBackpressure(r)
+	if err != nil {
+		return nil, err
+	}
+	return newHubClient(kind, parseEventFilter(r), parseLastEventId(r), policy, buffer), nil
+}
+
+func newHubClient(kind string, filter eventFilter, lastEventId uint64, policy slowConsumerPolicy, buffer int) *Client {
+	return &Client{
+		kind:        kind,
+		send:        make(chan *hubEvent, buffer),
+		policy:      policy,
+		filter:      filter,
+		lastEventId: lastEventId,
+	}
+}
+
+// ClientStats is the per-client view returned by /state/hub/clients.
+type ClientStats struct {
+	Id       uint64             `json:"id"`
+	Kind     string             `json:"kind"`
+	Policy   slowConsumerPolicy `json:"policy"`
+	Buffer   int                `json:"buffer"`
+	Queued   int                `json:"queued"`
+	Dropped  uint64             `json:"dropped"`
+	Types    []string           `json:"types,omitempty"`
+	Elements []string           `json:"elements,omitempty"`
+}
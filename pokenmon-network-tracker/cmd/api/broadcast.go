@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/webhook"
+	"strings"
+	"time"
+)
+
+// setupBroadcaster builds the composite broadcaster used by the whole pipeline.
+// The WebSocket hub and the webhook subscriptions are always registered;
+// the other sinks are enabled via the broadcast settings:
+//
+//	log: true                 structured JSON events on stdout
+//	file: /path/to/file       JSON-lines file, rotated at fileMaxBytes
+//	webhooks: [url1, url2]    POST every event to each URL
+func (app *Config) setupBroadcaster() {
+	multi := broadcast.NewMulti()
+	multi.Add("hub", app.hub)
+
+	app.webhooks = webhook.NewManager()
+	multi.Add("webhooks", app.webhooks)
+
+	cfg := app.cfg.Broadcast
+	if cfg.Log {
+		multi.Add("log", broadcast.NewLogSink(os.Stdout))
+	}
+
+	if cfg.File != "" {
+		fileSink, err := broadcast.NewFileSink(cfg.File, cfg.FileMaxBytes, 5)
+		if err != nil {
+			log.Printf("file broadcast sink disabled: %v", err)
+		} else {
+			multi.Add("file", fileSink)
+		}
+	}
+
+	// sinks are named by host, the rest of a webhook URL may carry a credential
+	for i, url := range cfg.Webhooks {
+		sink := broadcast.NewWebhookSink(url, 5*time.Second)
+		multi.Add(fmt.Sprintf("webhook %d (%s)", i+1, sink.Host()), sink)
+	}
+
+	log.Printf("Broadcasting to sinks: %s", strings.Join(multi.Sinks(), ", "))
+	app.broadcaster = multi
+}
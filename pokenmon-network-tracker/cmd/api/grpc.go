@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/idempotency"
+	"pokemonSightingApp/cmd/internal/ratelimit"
+	"pokemonSightingApp/cmd/internal/trackerpb"
+	"pokemonSightingApp/cmd/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// grpcRoles maps each RPC to the roles allowed to call it, mirroring routes().
+var grpcRoles = map[string][]auth.Role{
+	trackerpb.Tracker_ReportSighting_FullMethodName: {auth.SightingReporter},
+	trackerpb.Tracker_SpawnAgent_FullMethodName:     {auth.Operator},
+	trackerpb.Tracker_SpawnTeam_FullMethodName:      {auth.Operator},
+	trackerpb.Tracker_GetQueueStats_FullMethodName:  {auth.Observer, auth.SightingReporter, auth.Operator},
+	trackerpb.Tracker_ListAgents_FullMethodName:     {auth.Observer, auth.SightingReporter, auth.Operator},
+	trackerpb.Tracker_WatchEvents_FullMethodName:    {auth.Observer, auth.SightingReporter, auth.Operator},
+}
+
+// grpcRoutes maps each RPC onto the HTTP route it mirrors, so both share a rate limit bucket.
+var grpcRoutes = map[string]string{
+	trackerpb.Tracker_ReportSighting_FullMethodName: "POST /v1/sightings",
+	trackerpb.Tracker_SpawnAgent_FullMethodName:     "POST /v1/agents",
+	trackerpb.Tracker_SpawnTeam_FullMethodName:      "POST /v1/teams",
+	trackerpb.Tracker_GetQueueStats_FullMethodName:  "GET /v1/queues/{name}",
+	trackerpb.Tracker_ListAgents_FullMethodName:     "GET /v1/agents",
+	trackerpb.Tracker_WatchEvents_FullMethodName:    "GET /v1/events",
+}
+
+type trackerServer struct {
+	trackerpb.UnimplementedTrackerServer
+	app *Config
+}
+
+// newGRPCServer builds the gRPC API served on grpc.port next to the HTTP server.
+func (app *Config) newGRPCServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(app.grpcUnaryAuth),
+		grpc.StreamInterceptor(app.grpcStreamAuth),
+	)
+	trackerpb.RegisterTrackerServer(srv, &trackerServer{app: app})
+	return srv
+}
+
+// serveGRPC blocks until srv is stopped.
+func serveGRPC(srv *grpc.Server, port int) error {
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Serving gRPC on :%d", port)
+	return srv.Serve(lis)
+}
+
+// ReportSighting publishes a sighting behind the same idempotency key and
+// team quota checks as POST /v1/sightings.
+func (s *trackerServer) ReportSighting(ctx context.Context, req *trackerpb.ReportSightingRequest) (*trackerpb.Sighting, error) {
+	app := s.app
+	if key := incoming(ctx, "idempotency-key"); key != "" {
+		if len(key) > maxIdempotencyKey {
+			return nil, status.Errorf(codes.InvalidArgument, "idempotency-key must be at most %d characters", maxIdempotencyKey)
+		}
+		body, err := proto.MarshalOptions{Deterministic: true}.Marshal(req)
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to read request")
+		}
+		sum := sha256.Sum256(body)
+
+		scoped := grpcCaller(ctx) + "|" + trackerpb.Tracker_ReportSighting_FullMethodName + "|" + key
+		stored, err := app.idempotency.Begin(scoped, hex.EncodeToString(sum[:]))
+		switch {
+		case errors.Is(err, idempotency.ErrMismatch), errors.Is(err, idempotency.ErrInFlight):
+			return nil, status.Error(codes.Aborted, err.Error())
+		case stored != nil:
+			var sighting trackerpb.Sighting
+			if err := proto.Unmarshal(stored.Body, &sighting); err != nil {
+				return nil, status.Error(codes.Internal, "failed to replay response")
+			}
+			grpc.SetHeader(ctx, metadata.Pairs("idempotent-replayed", "true"))
+			return &sighting, nil
+		}
+
+		// release the key unless a response was stored, like idempotent does
+		completed := false
+		defer func() {
+			if !completed {
+				app.idempotency.Release(scoped)
+			}
+		}()
+		sighting, err := s.reportSighting(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		body, _ = proto.Marshal(sighting)
+		app.idempotency.Complete(scoped, &idempotency.Response{Body: body})
+		completed = true
+		return sighting, nil
+	}
+	return s.reportSighting(ctx, req)
+}
+
+// reportSighting charges the caller's team quota and publishes the sighting,
+// refunding the quota when it could not be published.
+func (s *trackerServer) reportSighting(ctx context.Context, req *trackerpb.ReportSightingRequest) (*trackerpb.Sighting, error) {
+	p, _ := auth.FromContext(ctx)
+	var charge ratelimit.Charge
+	if p.Team != "" {
+		var ok bool
+		charge, ok = s.app.limiter.UseQuota(p.Team)
+		if charge.Remaining >= 0 {
+			grpc.SetHeader(ctx, metadata.Pairs("x-quota-remaining", strconv.Itoa(charge.Remaining)))
+		}
+		if !ok {
+			grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(time.Until(charge.Reset).Seconds())))))
+			return nil, status.Errorf(codes.ResourceExhausted, "daily sighting quota exceeded for team %s", p.Team)
+		}
+	}
+
+	sighting, err := s.app.service.ReportSighting(ctx, event.Sighting{
+		Pokemon:  req.GetPokemon(),
+		Location: req.GetLocation(),
+		Element:  req.GetElement(),
+		Reporter: reporterFrom(ctx),
+	})
+	if err != nil {
+		s.app.limiter.Refund(charge)
+		return nil, grpcError(err, "failed to publish sighting")
+	}
+
+	return &trackerpb.Sighting{
+		Pokemon:     sighting.Pokemon,
+		Location:    sighting.Location,
+		Element:     sighting.Element,
+		Reporter:    sighting.Reporter,
+		CaptureTime: int32(sighting.CaptureTime),
+	}, nil
+}
+
+func (s *trackerServer) SpawnAgent(ctx context.Context, req *trackerpb.SpawnAgentRequest) (*trackerpb.Agent, error) {
+	agent, err := s.app.service.SpawnAgent(ctx, req.GetName(), int(req.GetImageNum()))
+	if err != nil {
+		return nil, grpcError(err, "failed to set up a new rocket agent")
+	}
+	return agentProto(agent), nil
+}
+
+func (s *trackerServer) SpawnTeam(ctx context.Context, req *trackerpb.SpawnTeamRequest) (*trackerpb.Team, error) {
+	team, err := s.app.service.SpawnTeam(ctx, req.GetName(), req.GetElements())
+	if err != nil {
+		return nil, grpcError(err, "failed to set up a new team")
+	}
+	return &trackerpb.Team{Name: team.Name, Elements: team.Elements, Topics: team.Topics}, nil
+}
+
+func (s *trackerServer) GetQueueStats(ctx context.Context, req *trackerpb.GetQueueStatsRequest) (*trackerpb.QueueStats, error) {
+	qs, err := s.app.service.QueueStats(ctx, req.GetName())
+	if err != nil {
+		return nil, grpcError(err, "failed to get queue stats")
+	}
+	return &trackerpb.QueueStats{Name: qs.Name, Messages: int32(qs.Messages), Consumers: int32(qs.Consumers)}, nil
+}
+
+func (s *trackerServer) ListAgents(ctx context.Context, req *trackerpb.ListAgentsRequest) (*trackerpb.ListAgentsResponse, error) {
+	var resp trackerpb.ListAgentsResponse
+	for _, agent := range s.app.service.ListAgents() {
+		resp.Agents = append(resp.Agents, agentProto(agent))
+	}
+	return &resp, nil
+}
+
+// WatchEvents registers a hub client just like the WebSocket and SSE streams,
+// with the slow-consumer policy and buffer the caller asked for.
+func (s *trackerServer) WatchEvents(req *trackerpb.WatchEventsRequest, stream trackerpb.Tracker_WatchEventsServer) error {
+	policy, buffer, err := backpressure(slowConsumerPolicy(req.GetPolicy()), int(req.GetBuffer()))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	filter := eventFilter{types: req.GetTypes(), elements: req.GetElements()}
+	client := newHubClient("grpc", filter, req.GetLastEventId(), policy, buffer)
+
+	hub := s.app.hub
+	hub.register <- client
+	defer func() {
+		hub.unregister <- client
+	}()
+
+	for {
+		select {
+		case e, ok := <-client.send:
+			if !ok {
+				if client.shutdown {
+					return status.Error(codes.Unavailable, client.closeReason)
+				}
+				if client.closeReason != "" {
+					return status.Error(codes.ResourceExhausted, client.closeReason)
+				}
+				return nil
+			}
+			err := stream.Send(&trackerpb.Event{
+				Id:      e.id,
+				Type:    e.messageType,
+				Element: e.element,
+				Payload: e.payload,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+// grpcError maps a service error onto a gRPC status, like serviceError does for HTTP.
+func grpcError(err error, msg string) error {
+	switch {
+	case errors.Is(err, service.ErrInvalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrDraining), errors.Is(err, service.ErrNoCapacity):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, service.ErrUnavailable):
+		log.Println(err)
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		log.Println(err)
+		return status.Error(codes.Internal, msg)
+	}
+}
+
+func agentProto(a event.AgentInfo) *trackerpb.Agent {
+	return &trackerpb.Agent{Id: int32(a.Id), Name: a.Name, ImageNum: int32(a.ImageNum)}
+}
+
+func (app *Config) grpcUnaryAuth(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := app.grpcAuthorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := app.grpcRateLimit(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (app *Config) grpcStreamAuth(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := app.grpcAuthorize(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	if err := app.grpcRateLimit(ctx, info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// grpcRateLimit takes a token from the bucket of the HTTP route the RPC mirrors, like rateLimit.
+func (app *Config) grpcRateLimit(ctx context.Context, method string) error {
+	route, ok := grpcRoutes[method]
+	if !ok {
+		route = method
+	}
+	if ok, wait := app.limiter.Allow(route, grpcCaller(ctx)); !ok {
+		grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		return status.Error(codes.ResourceExhausted, "rate limit exceeded")
+	}
+	return nil
+}
+
+// grpcCaller keys the caller like clientKey, by credential or by peer address.
+func grpcCaller(ctx context.Context) string {
+	var addr string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		addr = p.Addr.String()
+	}
+	return callerKey(ctx, addr)
+}
+
+// incoming returns the first value of the metadata key, or "".
+func incoming(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// grpcAuthorize reads the credential from the "x-api-key" or "authorization: Bearer" metadata.
+func (app *Config) grpcAuthorize(ctx context.Context, method string) (context.Context, error) {
+	if app.cfg.Auth.Disabled {
+		return auth.WithPrincipal(ctx, auth.Principal{Subject: "anonymous", Role: auth.Admin}), nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var token string
+	if v := md.Get("x-api-key"); len(v) > 0 {
+		token = v[0]
+	} else if v := md.Get("authorization"); len(v) > 0 && strings.HasPrefix(v[0], "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(v[0], "Bearer "))
+	}
+	if token == "" {
+		return nil, status.Error(codes.Unauthenticated, auth.ErrNoCredentials.Error())
+	}
+
+	p, err := app.auth.Verify(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if !p.Allowed(grpcRoles[method]...) {
+		return nil, status.Errorf(codes.PermissionDenied, "role %q is not allowed to call %s", p.Role, method)
+	}
+	return auth.WithPrincipal(ctx, p), nil
+}
+
+type authedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context {
+	return s.ctx
+}
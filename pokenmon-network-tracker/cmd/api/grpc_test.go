@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/config"
+	"pokemonSightingApp/cmd/internal/idempotency"
+	"pokemonSightingApp/cmd/internal/ratelimit"
+	"pokemonSightingApp/cmd/internal/trackerpb"
+	"pokemonSightingApp/cmd/service"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeBroker records published messages and fails the next fail publishes.
+type fakeBroker struct {
+	mu        sync.Mutex
+	published []service.Message
+	fail      int
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, msgs []service.Message) []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	errs := make([]error, len(msgs))
+	for i, m := range msgs {
+		if b.fail > 0 {
+			b.fail--
+			errs[i] = errors.New("broker unavailable")
+			continue
+		}
+		b.published = append(b.published, m)
+	}
+	return errs
+}
+
+func (b *fakeBroker) QueueStats(ctx context.Context, name string) (service.QueueStats, error) {
+	return service.QueueStats{Name: name}, nil
+}
+
+func (b *fakeBroker) PurgeQueues() error { return nil }
+
+func (b *fakeBroker) StartTeam(name string, elements []string, bc broadcast.Broadcaster) (service.Team, error) {
+	return service.Team{Name: name, Elements: elements}, nil
+}
+
+func (b *fakeBroker) count() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.published)
+}
+
+// startGRPC serves the gRPC API over an in-memory listener, with a
+// sighting-reporter key "red-key" for team red.
+func startGRPC(t *testing.T, limits ratelimit.Limits) (trackerpb.TrackerClient, *Config, *fakeBroker) {
+	t.Helper()
+	app := &Config{
+		cfg:         config.Default(),
+		limiter:     ratelimit.NewLimiter(limits),
+		idempotency: idempotency.NewStore(time.Hour),
+	}
+	app.cfg.Auth.APIKeys = []string{"sighting-reporter:red-key:red"}
+	if err := app.setupAuth(); err != nil {
+		t.Fatal(err)
+	}
+	app.hub = NewHub(app.cfg.Hub)
+	go app.hub.Run()
+	broker := &fakeBroker{}
+	app.service = service.New(broker, app.hub, event.NewFleet(time.Minute, 2*time.Minute), &event.EscapeCounter{}, service.Options{
+		Exchange:       "pokemon_exchange",
+		MinCaptureTime: 5 * time.Second,
+		MaxCaptureTime: 14 * time.Second,
+	})
+
+	lis := bufconn.Listen(1 << 20)
+	srv := app.newGRPCServer()
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return trackerpb.NewTrackerClient(conn), app, broker
+}
+
+func reporterContext(pairs ...string) context.Context {
+	return metadata.NewOutgoingContext(context.Background(), metadata.Pairs(append([]string{"x-api-key", "red-key"}, pairs...)...))
+}
+
+var charmander = &trackerpb.ReportSightingRequest{Pokemon: "Charmander", Location: "Route 24", Element: "fire"}
+
+func TestGRPCReportSightingIsIdempotent(t *testing.T) {
+	client, _, broker := startGRPC(t, ratelimit.DefaultLimits())
+	ctx := reporterContext("idempotency-key", "k1")
+
+	first, err := client.ReportSighting(ctx, charmander)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header metadata.MD
+	again, err := client.ReportSighting(ctx, charmander, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if broker.count() != 1 {
+		t.Errorf("published %d sightings, want 1", broker.count())
+	}
+	if again.GetCaptureTime() != first.GetCaptureTime() || again.GetReporter() != "red" {
+		t.Errorf("replayed %v, want %v", again, first)
+	}
+	if v := header.Get("idempotent-replayed"); len(v) == 0 || v[0] != "true" {
+		t.Errorf("idempotent-replayed header = %v", v)
+	}
+
+	other := &trackerpb.ReportSightingRequest{Pokemon: "Squirtle", Location: "Vermilion City", Element: "water"}
+	if _, err := client.ReportSighting(ctx, other); status.Code(err) != codes.Aborted {
+		t.Errorf("reused key with another sighting: %v, want Aborted", err)
+	}
+}
+
+func TestGRPCReportSightingRetriesAfterFailure(t *testing.T) {
+	client, _, broker := startGRPC(t, ratelimit.DefaultLimits())
+	ctx := reporterContext("idempotency-key", "k1")
+
+	broker.fail = 1
+	if _, err := client.ReportSighting(ctx, charmander); status.Code(err) != codes.Internal {
+		t.Fatalf("err = %v, want Internal", err)
+	}
+	if _, err := client.ReportSighting(ctx, charmander); err != nil {
+		t.Fatalf("retry with the same key: %v", err)
+	}
+	if broker.count() != 1 {
+		t.Errorf("published %d sightings, want 1", broker.count())
+	}
+}
+
+func TestGRPCReportSightingChargesQuota(t *testing.T) {
+	limits := ratelimit.DefaultLimits()
+	limits.DailyQuota = 1
+	client, app, broker := startGRPC(t, limits)
+	ctx := reporterContext()
+
+	// a sighting the broker refused is refunded
+	broker.fail = 1
+	if _, err := client.ReportSighting(ctx, charmander); status.Code(err) != codes.Internal {
+		t.Fatalf("err = %v, want Internal", err)
+	}
+	if got := app.limiter.Usage()["red"]; got != 0 {
+		t.Errorf("usage after a failed publish = %d, want 0", got)
+	}
+
+	var header metadata.MD
+	if _, err := client.ReportSighting(ctx, charmander, grpc.Header(&header)); err != nil {
+		t.Fatal(err)
+	}
+	if v := header.Get("x-quota-remaining"); len(v) == 0 || v[0] != "0" {
+		t.Errorf("x-quota-remaining = %v, want 0", v)
+	}
+	if _, err := client.ReportSighting(ctx, charmander); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("err = %v, want ResourceExhausted", err)
+	}
+}
+
+func TestGRPCSharesTheHTTPRateLimit(t *testing.T) {
+	limits := ratelimit.DefaultLimits()
+	limits.Routes["POST /v1/sightings"] = ratelimit.Rule{Rate: 0.001, Burst: 1}
+	client, app, _ := startGRPC(t, limits)
+
+	if _, err := client.ReportSighting(reporterContext(), charmander); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReportSighting(reporterContext(), charmander); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("err = %v, want ResourceExhausted", err)
+	}
+	// the HTTP route draws from the same bucket
+	if ok, _ := app.limiter.Allow("POST /v1/sightings", "sub:"+string(auth.SightingReporter)+"-key-1"); ok {
+		t.Error("HTTP bucket was not charged by the gRPC call")
+	}
+	if _, err := client.ListAgents(reporterContext(), &trackerpb.ListAgentsRequest{}); err != nil {
+		t.Errorf("other routes keep their own bucket: %v", err)
+	}
+}
+
+func TestGRPCWatchEventsAppliesBackpressure(t *testing.T) {
+	client, app, _ := startGRPC(t, ratelimit.DefaultLimits())
+
+	stream, err := client.WatchEvents(reporterContext(), &trackerpb.WatchEventsRequest{Policy: "sometimes"})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("err = %v, want InvalidArgument", err)
+	}
+
+	ctx, cancel := context.WithCancel(reporterContext())
+	defer cancel()
+	stream, err = client.WatchEvents(ctx, &trackerpb.WatchEventsRequest{Policy: string(dropNewest), Buffer: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := stream.Recv(); err != nil || e.GetType() != "register" {
+		t.Fatalf("first event = %v, %v", e, err)
+	}
+	stats := app.hub.ClientStats()
+	if len(stats) != 1 || stats[0].Policy != dropNewest || stats[0].Buffer != 8 {
+		t.Errorf("hub clients = %+v", stats)
+	}
+}
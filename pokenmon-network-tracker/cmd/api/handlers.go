@@ -1,39 +1,57 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"log"
-	"math/rand"
 	"net/http"
 	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/service"
+	"sync/atomic"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
-	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-var agentId int = 1
-
 type SightingPayload struct {
-	event.Sighting
-	CaptureTime int    `json:"captureTime,omitempty"`
-	Message     string `json:"message"`
+	event.QueueSighting
+	Message string `json:"message"`
 }
 
 type RocketAgentPayload struct {
-	event.RocketAgent
-	Message  string `json:"message"`
-	ImageNum int    `json:"imageNum"`
+	event.AgentInfo
+	Message string `json:"message"`
 }
 
 type Client struct {
-	conn     *websocket.Conn
-	send     chan []byte
-	lastPong time.Time
+	id          uint64
+	kind        string
+	conn        *websocket.Conn
+	send        chan *hubEvent
+	lastPong    atomic.Int64
+	filter      eventFilter
+	lastEventId uint64
+	policy      slowConsumerPolicy
+	dropped     atomic.Uint64
+	// closeReason is set by the hub before it closes send
+	closeReason string
+	// shutdown is set when send was closed because the server is stopping
+	shutdown bool
 }
 
+// SightingHandle serves the deprecated POST /sighting.
 func (app *Config) SightingHandle(w http.ResponseWriter, r *http.Request) {
+	app.reportSighting(w, r, http.StatusOK)
+}
+
+// CreateSighting queues a sighting for dispatch and answers 202.
+func (app *Config) CreateSighting(w http.ResponseWriter, r *http.Request) {
+	app.reportSighting(w, r, http.StatusAccepted)
+}
+
+func (app *Config) reportSighting(w http.ResponseWriter, r *http.Request, status int) {
 	// parse info from request into SightingPayload
 	var s SightingPayload
 
@@ -41,21 +59,22 @@ func (app *Config) SightingHandle(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
 		return
 	}
 
+	// record who reported it so duplicate sightings can be attributed
+	s.Reporter = reporterFrom(r.Context())
+
 	// Publish the Sighting
-	err = app.publishSighting(s)
+	s.QueueSighting, err = app.service.ReportSighting(r.Context(), s.Sighting)
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "failed to publish sighting", http.StatusInternalServerError)
+		serviceError(w, r, err, "failed to publish sighting")
 		return
 	}
 
-	// 200 OK - Successfully submitted Pokemon sighting
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 
 	s.Message = "Successfully submitted Pokemon sighting"
 	out, _ := json.Marshal(s)
@@ -63,139 +82,137 @@ func (app *Config) SightingHandle(w http.ResponseWriter, r *http.Request) {
 }
 
 type TeamPayload struct {
-	event.Team
+	service.Team
 	Message string `json:"message"`
 }
 
 type QueuePayload struct {
-	event.QueueStats
+	service.QueueStats
 	Message string `json:"message,omitempty"`
 }
 
+// SpawnTeam serves the deprecated POST /spawn/team.
 func (app *Config) SpawnTeam(w http.ResponseWriter, r *http.Request) {
+	app.createTeam(w, r, http.StatusOK)
+}
+
+func (app *Config) CreateTeam(w http.ResponseWriter, r *http.Request) {
+	app.createTeam(w, r, http.StatusCreated)
+}
+
+func (app *Config) createTeam(w http.ResponseWriter, r *http.Request, status int) {
 	// parse info from request into
 	var t TeamPayload
 
 	err := app.readJSON(w, r, &t)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
 		return
 	}
 
-	team, err := event.NewTeam(app.rabbitConn, t.Name, t.Elements, app.hub)
+	team, err := app.service.SpawnTeam(r.Context(), t.Name, t.Elements)
 	t.Team = team
 
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "failed to set up a new team", http.StatusInternalServerError)
+		serviceError(w, r, err, "failed to set up a new team")
 		return
 	}
 
-	go func() {
-		if err := team.Listen(); err != nil {
-			log.Println(err)
-			http.Error(w, "Team listen failed", http.StatusInternalServerError)
-			return
-		}
-	}()
-
-	// 200 OK - Successfully created a Rocket agent
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	t.Message = "Successfully created a Team"
 	out, _ := json.Marshal(t)
 	w.Write(out)
 }
 
+// SpawnRocketAgent serves the deprecated POST /spawn/rocket-agent.
 func (app *Config) SpawnRocketAgent(w http.ResponseWriter, r *http.Request) {
+	app.createAgent(w, r, http.StatusOK)
+}
+
+func (app *Config) CreateAgent(w http.ResponseWriter, r *http.Request) {
+	app.createAgent(w, r, http.StatusCreated)
+}
+
+func (app *Config) createAgent(w http.ResponseWriter, r *http.Request, status int) {
 	// parse info from request into
 	var a RocketAgentPayload
 
 	err := app.readJSON(w, r, &a)
-	a.Id = agentId
-	agentId++
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
 		return
 	}
 
-	agent, err := event.NewRocketAgent(app.rabbitConn, a.Id, a.Name, a.ImageNum, app.hub)
+	agent, err := app.service.SpawnAgent(r.Context(), a.Name, a.ImageNum)
 
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "failed to set up a new rocket agent", http.StatusInternalServerError)
+		serviceError(w, r, err, "failed to set up a new rocket agent")
 		return
 	}
+	a.AgentInfo = agent
 
-	go func() {
-		if err := agent.Listen(); err != nil {
-			log.Println(err)
-			http.Error(w, "Agent listen failed", http.StatusInternalServerError)
-			return
-		}
-	}()
-
-	// 200 OK - Successfully created a Rocket agent
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	a.Message = "Successfully created a Rocket agent"
-	out, _ := json.Marshal(a)
+	w.WriteHeader(status)
+	a.Message = "Rocket agent requested from the agent workers"
+	out, _ := json.Marshal(&a)
 	w.Write(out)
 }
 
-func (app *Config) publishSighting(s SightingPayload) error {
-	topic := fmt.Sprintf("pokemon.sighting.%s", s.Element)
-	conn := app.rabbitConn
-
-	s.CaptureTime = rand.Intn(10) + 5
-
-	msg := fmt.Sprintf("Spawned %s pokemon: %s at % s with capture time %d", s.Element, s.Pokemon, s.Location, s.CaptureTime)
-	app.hub.Broadcast(msg, "system log", true, nil)
-
-	if conn == nil {
-		return fmt.Errorf("rabbitmq not connected")
+// reporterFrom names the caller for sighting attribution: its team, or its subject when it has none.
+func reporterFrom(ctx context.Context) string {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return ""
 	}
-
-	ch, err := conn.Channel()
-	if err != nil {
-		return err
+	if p.Team != "" {
+		return p.Team
 	}
-	defer ch.Close()
-
-	body, err := json.Marshal(s)
-	if err != nil {
-		return fmt.Errorf("failed to marshal sighting: %w", err)
-	}
-
-	err = ch.Publish("pokemon_exchange", topic, false, false, amqp.Publishing{
-		ContentType: "application/json",
-		Body:        body,
-	})
-	return err
+	return p.Subject
 }
 
+// QueueStats serves the deprecated POST /state/queue, which names the queue in the body.
 func (app *Config) QueueStats(w http.ResponseWriter, r *http.Request) {
 	var q QueuePayload
 	err := json.NewDecoder(r.Body).Decode(&q)
 	if err != nil {
 		log.Println(err)
-		http.Error(w, "invalid input", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
 		return
 	}
-	qs, err := event.GetQueueStats(app.rabbitConn, q.Name)
+	app.writeQueueStats(w, r, q.Name)
+}
+
+func (app *Config) GetQueue(w http.ResponseWriter, r *http.Request) {
+	app.writeQueueStats(w, r, chi.URLParam(r, "name"))
+}
+
+// GetQueues reports every pipeline queue at once.
+func (app *Config) GetQueues(w http.ResponseWriter, r *http.Request) {
+	queues, err := app.service.PipelineQueueStats(r.Context())
 	if err != nil {
-		log.Println(err)
-		http.Error(w, "failed to get queue stats", http.StatusInternalServerError)
+		serviceError(w, r, err, "failed to get queue stats")
 		return
 	}
 
-	q.QueueStats = qs
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(queues)
+	w.Write(out)
+}
+
+func (app *Config) writeQueueStats(w http.ResponseWriter, r *http.Request, name string) {
+	qs, err := app.service.QueueStats(r.Context(), name)
+	if err != nil {
+		serviceError(w, r, err, "failed to get queue stats")
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	out, _ := json.Marshal(q)
+	out, _ := json.Marshal(QueuePayload{QueueStats: qs})
 	w.Write(out)
 	// log.Println("Queue stats: ", string(out))
 }
@@ -203,26 +220,29 @@ func (app *Config) QueueStats(w http.ResponseWriter, r *http.Request) {
 var upgrader = websocket.Upgrader{}
 
 func serveWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	// create client
+	client, err := newClient(r, "websocket")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
 	// upgrade request to WS
 	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
 
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		http.Error(w, "WS upgrade failing", http.StatusInternalServerError)
+		log.Println(err)
 		return
 	}
-
-	// create client
-	client := &Client{
-		conn:     conn,
-		send:     make(chan []byte, 1024),
-		lastPong: time.Now(),
-	}
+	client.conn = conn
+	client.lastPong.Store(time.Now().UnixNano())
 
 	// registering client
 	hub.register <- client
 
 	// keep client running
+	hub.writers.Add(1)
 	go client.readPump(hub)
 	go client.writePump(hub)
 }
@@ -233,10 +253,10 @@ func (c *Client) readPump(hub *Hub) {
 		c.conn.Close()
 	}()
 	c.conn.SetReadLimit(512)
-	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetReadDeadline(time.Now().Add(hub.settings.ReadTimeout))
 	c.conn.SetPongHandler(func(string) error {
-		c.lastPong = time.Now()
-		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.lastPong.Store(time.Now().UnixNano())
+		c.conn.SetReadDeadline(time.Now().Add(hub.settings.ReadTimeout))
 		return nil
 	})
 
@@ -249,30 +269,32 @@ func (c *Client) readPump(hub *Hub) {
 
 func (c *Client) writePump(hub *Hub) {
 
-	pingTicket := time.NewTicker(5 * time.Second)
+	pingTicket := time.NewTicker(hub.settings.PingInterval)
 	defer func() {
 		c.conn.Close()
 		pingTicket.Stop()
+		hub.writers.Done()
 	}()
 
-	c.conn.SetPongHandler(func(string) error {
-		c.lastPong = time.Now()
-		return nil
-	})
-
 	for {
 		select {
 		case msg, ok := <-c.send:
 			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				if c.shutdown {
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, c.closeReason))
+				} else if c.closeReason != "" {
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, c.closeReason))
+				} else {
+					c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				}
 				return
 			}
-			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg.payload); err != nil {
 				return
 			}
 
 		case <-pingTicket.C:
-			if time.Since(c.lastPong) > 15*time.Second {
+			if time.Since(time.Unix(0, c.lastPong.Load())) > hub.settings.PongTimeout {
 				hub.unregister <- c
 				return
 			}
@@ -288,25 +310,25 @@ func (app *Config) StreamEventWS(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *Config) ResetAgents(w http.ResponseWriter, r *http.Request) {
-	event.DeleteAllAgents()
+	if err := app.service.ResetAgents(r.Context()); err != nil {
+		serviceError(w, r, err, "failed to stop agents")
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *Config) ResetSystem(w http.ResponseWriter, r *http.Request) {
-	event.DeleteAllAgents()
-	// Reset queues to clear stale consumer metadata
-	if err := event.ResetAllQueues(); err != nil {
-		log.Printf("Failed to reset queues: %v", err)
-		// Don't fail the request, just log the error
+	if err := app.service.ResetSystem(r.Context()); err != nil {
+		serviceError(w, r, err, "failed to reset system")
+		return
 	}
-	event.ReSetTotalCount()
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (app *Config) GetDLQTotalCount(w http.ResponseWriter, r *http.Request) {
-	count := event.GetDLQTotalCount()
+	count := app.service.EscapeCount()
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
@@ -317,7 +339,21 @@ func (app *Config) GetDLQTotalCount(w http.ResponseWriter, r *http.Request) {
 func (app *Config) GetAgentsState(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	out, _ := json.Marshal(event.AgentList)
+	out, _ := json.Marshal(app.service.ListAgents())
+	w.Write(out)
+}
+
+func (app *Config) GetWorkers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(app.service.ListWorkers())
+	w.Write(out)
+}
+
+func (app *Config) GetHubClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(app.hub.ClientStats())
 	w.Write(out)
 }
 
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"pokemonSightingApp/cmd/event"
+	"time"
+)
+
+// probeTimeout bounds each readiness check so a stalled broker cannot hang the probe.
+const probeTimeout = 2 * time.Second
+
+type ComponentHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type HealthPayload struct {
+	Status     string                     `json:"status"`
+	Components map[string]ComponentHealth `json:"components,omitempty"`
+}
+
+// Healthz reports that the process is up and serving requests.
+func (app *Config) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(HealthPayload{Status: "ok"})
+	w.Write(out)
+}
+
+// Readyz reports whether every component the pipeline depends on is working,
+// answering 503 with the per-component breakdown when one is not.
+func (app *Config) Readyz(w http.ResponseWriter, r *http.Request) {
+	p := HealthPayload{Status: "ok", Components: app.readiness()}
+	status := http.StatusOK
+	for _, c := range p.Components {
+		if c.Status != "ok" {
+			p.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	out, _ := json.Marshal(p)
+	w.Write(out)
+}
+
+func (app *Config) readiness() map[string]ComponentHealth {
+	components := map[string]ComponentHealth{}
+
+	brokerUp := app.rabbitConn != nil && !app.rabbitConn.IsClosed()
+	if brokerUp {
+		components["broker"] = healthOf(nil)
+		components["topology"] = healthOf(withTimeout(func() error { return event.CheckTopology(app.rabbitConn, app.topology()) }))
+		// the dispatcher and DLQ logger run elsewhere; they are up while they consume their queue
+		components["dispatcher"] = healthOf(withTimeout(func() error { return app.consumed(app.cfg.Broker.SightingQueue) }))
+		components["dlq"] = healthOf(withTimeout(func() error { return app.consumed(app.cfg.Broker.DeadLetterQueue) }))
+	} else {
+		unavailable := healthOf(errors.New("broker unavailable"))
+		components["broker"] = healthOf(errors.New("connection closed"))
+		components["topology"] = unavailable
+		components["dispatcher"] = unavailable
+		components["dlq"] = unavailable
+	}
+
+	if app.service.Draining() {
+		components["intake"] = healthOf(errors.New("shutting down, not accepting sightings"))
+	} else {
+		components["intake"] = healthOf(nil)
+	}
+	components["bus"] = running(app.bus)
+
+	if app.hub.Responsive(probeTimeout) {
+		components["hub"] = healthOf(nil)
+	} else {
+		components["hub"] = healthOf(errors.New("event loop not responding"))
+	}
+	return components
+}
+
+func running(s *event.Consumer) ComponentHealth {
+	if s.Running() {
+		return healthOf(nil)
+	}
+	return healthOf(errors.New("consumer not running"))
+}
+
+func (app *Config) consumed(queue string) error {
+	qs, err := event.GetQueueStats(app.rabbitConn, queue)
+	if err != nil {
+		return err
+	}
+	if qs.Consumers == 0 {
+		return fmt.Errorf("no consumers on %s", queue)
+	}
+	return nil
+}
+
+func healthOf(err error) ComponentHealth {
+	if err != nil {
+		return ComponentHealth{Status: "down", Error: err.Error()}
+	}
+	return ComponentHealth{Status: "ok"}
+}
+
+// withTimeout runs check, giving up after probeTimeout.
+func withTimeout(check func() error) error {
+	done := make(chan error, 1)
+	go func() { done <- check() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(probeTimeout):
+		return errors.New("check timed out")
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"log"
 	"net/http"
+	"pokemonSightingApp/cmd/service"
+
+	"github.com/go-chi/chi/middleware"
 )
 
 // readJSON tries to read the body of a request and converts it into JSON
@@ -26,3 +30,71 @@ func (app *Config) readJSON(w http.ResponseWriter, r *http.Request, data any) er
 
 	return nil
 }
+
+// Error codes carried in ErrorPayload.Code.
+const (
+	codeInvalidRequest   = "invalid_request"
+	codeValidation       = "validation_failed"
+	codeUnauthorized     = "unauthorized"
+	codeForbidden        = "forbidden"
+	codeNotFound         = "not_found"
+	codeConflict         = "conflict"
+	codeUnsupportedMedia = "unsupported_media_type"
+	codeRateLimited      = "rate_limited"
+	codeQuotaExceeded    = "quota_exceeded"
+	codeUnavailable      = "unavailable"
+	codeInternal         = "internal"
+)
+
+// ErrorPayload is the body of every error response.
+type ErrorPayload struct {
+	Code      string               `json:"code"`
+	Message   string               `json:"message"`
+	Fields    []service.FieldError `json:"fields,omitempty"`
+	RequestId string               `json:"requestId,omitempty"`
+}
+
+// writeError sends an ErrorPayload tagged with the request's id.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code string, message string, fields ...service.FieldError) {
+	out, _ := json.Marshal(ErrorPayload{
+		Code:      code,
+		Message:   message,
+		Fields:    fields,
+		RequestId: middleware.GetReqID(r.Context()),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(out)
+}
+
+// serviceError maps a service error onto an HTTP status. Unexpected errors
+// are logged and reported with the generic msg.
+func serviceError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		writeError(w, r, http.StatusBadRequest, codeValidation, "request failed validation", invalid.Fields...)
+	case errors.Is(err, service.ErrInvalid):
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, codeNotFound, err.Error())
+	case errors.Is(err, service.ErrDraining), errors.Is(err, service.ErrNoCapacity):
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, err.Error())
+	case errors.Is(err, service.ErrUnavailable):
+		log.Println(err)
+		writeError(w, r, http.StatusServiceUnavailable, codeUnavailable, err.Error())
+	default:
+		log.Println(err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, msg)
+	}
+}
+
+// requestId tags each request with an id, taken from X-Request-Id when the
+// caller sent one, and echoes it back in the response header.
+func requestId(next http.Handler) http.Handler {
+	return middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(middleware.RequestIDHeader, middleware.GetReqID(r.Context()))
+		next.ServeHTTP(w, r)
+	}))
+}
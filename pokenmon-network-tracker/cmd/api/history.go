@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/history"
+	"pokemonSightingApp/cmd/service"
+	"strings"
+	"time"
+)
+
+// defaultHistoryRange is how far back a query without from looks.
+const defaultHistoryRange = time.Hour
+
+type HistoryPayload struct {
+	Metric string          `json:"metric"`
+	From   time.Time       `json:"from"`
+	To     time.Time       `json:"to"`
+	Step   string          `json:"step"`
+	Points []history.Point `json:"points"`
+}
+
+// GetHistory serves GET /v1/history?metric=&from=&to=&step=. from and to take
+// an RFC 3339 time or a duration ago such as 30m; step defaults to the
+// sampling interval.
+func (app *Config) GetHistory(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now()
+	var fields []service.FieldError
+	invalid := func(field, message string) {
+		fields = append(fields, service.FieldError{Field: field, Message: message})
+	}
+
+	metric := q.Get("metric")
+	if metric == "" {
+		invalid("metric", "is required, one of "+strings.Join(app.history.Metrics(), ", "))
+	}
+	from, err := historyTime(q.Get("from"), now, now.Add(-defaultHistoryRange))
+	if err != nil {
+		invalid("from", err.Error())
+	}
+	to, err := historyTime(q.Get("to"), now, now)
+	if err != nil {
+		invalid("to", err.Error())
+	}
+	step := app.cfg.History.Interval
+	if raw := q.Get("step"); raw != "" {
+		if step, err = time.ParseDuration(raw); err != nil || step <= 0 {
+			invalid("step", "must be a positive duration such as 1m")
+		}
+	}
+	if len(fields) > 0 {
+		writeError(w, r, http.StatusBadRequest, codeValidation, "request failed validation", fields...)
+		return
+	}
+
+	points, err := app.history.Query(metric, from, to, step)
+	switch {
+	case errors.Is(err, history.ErrUnknownMetric):
+		writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("%v, known metrics: %s", err, strings.Join(app.history.Metrics(), ", ")))
+		return
+	case err != nil:
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(HistoryPayload{Metric: metric, From: from, To: to, Step: step.String(), Points: points})
+	w.Write(out)
+}
+
+// historyTime parses an RFC 3339 time or a duration before now, returning def for "".
+func historyTime(raw string, now, def time.Time) (time.Time, error) {
+	if raw == "" {
+		return def, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(strings.TrimPrefix(raw, "-")); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, errors.New("must be an RFC 3339 time or a duration ago such as 30m")
+}
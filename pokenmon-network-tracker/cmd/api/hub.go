@@ -1,81 +1,367 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/config"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
+const (
+	// historySize is how many recent events the hub keeps for Last-Event-ID resume.
+	historySize = 512
+	// broadcastBuffer bounds how many events can wait for the Run loop before Broadcast starts dropping.
+	broadcastBuffer = 4096
+	// dropReportInterval is how often the hub reports dropped messages as a "hub backpressure" event.
+	dropReportInterval = 10 * time.Second
+)
+
 type Hub struct {
 	clients    map[*Client]bool
 	register   chan *Client
 	unregister chan *Client
-	broadcast  chan []byte
+	broadcast  chan *hubEvent
+	stats      chan chan []ClientStats
+	history    []*hubEvent
+	// nextId numbers events as they are published, so history ids only grow
+	nextId   uint64
+	clientId uint64
+	// pending holds drop notices of removed clients, published once the current event is out
+	pending []*hubEvent
+	// dropped counts events Broadcast discarded because the Run loop was behind
+	dropped atomic.Uint64
+	// reported holds the per-client drop counts already announced
+	reported map[*Client]uint64
+	shutdown chan string
+	// closeReason is set once the hub shut down; later clients are closed on arrival
+	closeReason string
+	// writers tracks websocket write pumps so shutdown can wait for their close frames
+	writers sync.WaitGroup
+	// settings holds the websocket keep-alive timings
+	settings config.Hub
+}
+
+// hubEvent is a marshalled broadcast plus the metadata clients filter on.
+type hubEvent struct {
+	id          uint64
+	messageType string
+	element     string
+	payload     []byte
+}
+
+// eventFilter restricts which events a client receives. Empty fields match everything.
+type eventFilter struct {
+	types    []string
+	elements []string
+}
+
+// parseEventFilter reads the "types" and "elements" query parameters.
+// Both accept repeated parameters and comma-separated values.
+func parseEventFilter(r *http.Request) eventFilter {
+	split := func(values []string) []string {
+		var out []string
+		for _, v := range values {
+			for _, part := range strings.Split(v, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					out = append(out, part)
+				}
+			}
+		}
+		return out
+	}
+	q := r.URL.Query()
+	return eventFilter{types: split(q["types"]), elements: split(q["elements"])}
+}
+
+func (f eventFilter) match(e *hubEvent) bool {
+	if len(f.types) > 0 && !slices.Contains(f.types, e.messageType) {
+		return false
+	}
+	if len(f.elements) > 0 && !slices.Contains(f.elements, e.element) {
+		return false
+	}
+	return true
+}
+
+// parseLastEventId reads the resume point from the Last-Event-ID header or the lastEventId query parameter.
+func parseLastEventId(r *http.Request) uint64 {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("lastEventId")
+	}
+	id, _ := strconv.ParseUint(v, 10, 64)
+	return id
 }
 
-func NewHub() *Hub {
+func NewHub(settings config.Hub) *Hub {
 	return &Hub{
+		settings:   settings,
 		clients:    make(map[*Client]bool),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan *hubEvent, broadcastBuffer),
+		stats:      make(chan chan []ClientStats),
+		reported:   make(map[*Client]uint64),
+		shutdown:   make(chan string),
 	}
 }
 
+// GetLiveCount returns the number of connected clients, counted on the Run goroutine.
 func (h *Hub) GetLiveCount() int {
-	return len(h.clients)
+	return len(h.ClientStats())
+}
+
+// ClientStats returns a snapshot of every connected client, taken on the Run goroutine.
+func (h *Hub) ClientStats() []ClientStats {
+	reply := make(chan []ClientStats)
+	h.stats <- reply
+	return <-reply
+}
+
+// Shutdown disconnects every client with reason and waits, until ctx is done,
+// for the websocket close frames to go out. Clients connecting afterwards are closed straight away.
+func (h *Hub) Shutdown(ctx context.Context, reason string) error {
+	select {
+	case h.shutdown <- reason:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	done := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Responsive reports whether the Run goroutine answers within timeout.
+func (h *Hub) Responsive(timeout time.Duration) bool {
+	// buffered so a late answer does not block Run
+	reply := make(chan []ClientStats, 1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case h.stats <- reply:
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-reply:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
 func (h *Hub) Run() {
+	report := time.NewTicker(dropReportInterval)
+	defer report.Stop()
+
 	// running forever
 	for {
 		select {
 		case c := <-h.register:
+			if h.closeReason != "" {
+				c.closeReason = h.closeReason
+				c.shutdown = true
+				close(c.send)
+				continue
+			}
 			// registering a new Client
+			h.clientId++
+			c.id = h.clientId
 			h.clients[c] = true
 			message := map[string]string{"type": "register", "message": "Client registered!"}
 			payload, _ := json.Marshal(message)
-			c.send <- payload
+			c.send <- &hubEvent{messageType: "register", payload: payload}
+			// replay what the client missed since its last event
+			if c.lastEventId > 0 {
+				for _, e := range h.history {
+					if e.id > c.lastEventId && c.filter.match(e) {
+						h.deliver(c, e)
+					}
+				}
+			}
 		case c := <-h.unregister:
 			// deleting a Client
 			if _, ok := h.clients[c]; ok {
-				delete(h.clients, c)
-				close(c.send)
+				h.remove(c, "")
 			}
-		case msg := <-h.broadcast:
+		case e := <-h.broadcast:
 			// pushing msgs to clients
+			h.publish(e)
+		case reply := <-h.stats:
+			reply <- h.snapshot()
+		case reason := <-h.shutdown:
+			h.closeReason = reason
 			for c := range h.clients {
-				select {
-				case c.send <- msg:
-				default:
-					close(c.send)
-					delete(h.clients, c)
-				}
+				c.shutdown = true
+				h.remove(c, reason)
 			}
+		case <-report.C:
+			h.reportDrops()
 		}
+		h.flushPending()
 	}
 }
 
-// Broadcast sends a message to all connected clients.
-// If includeTime is not provided, it defaults to true.
-func (h *Hub) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
-	message := map[string]any{"type": messageType, "message": msg}
+// flushPending publishes the queued drop notices. Publishing one can remove
+// another slow client and queue its notice in turn.
+func (h *Hub) flushPending() {
+	for len(h.pending) > 0 {
+		e := h.pending[0]
+		h.pending = h.pending[1:]
+		h.publish(e)
+	}
+}
 
-	if includeTime {
-		message["time"] = time.Now().Format("2006-01-02 15:04:05.000")
+// deliver queues e for c, applying the client's slow-consumer policy when its buffer is full.
+func (h *Hub) deliver(c *Client, e *hubEvent) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	select {
+	case c.send <- e:
+		return
+	default:
 	}
 
-	for _, key := range []string{"type", "message"} {
-		if _, ok := options[key]; ok {
-			log.Printf("error - broadcasting contains reserved key: %s", key)
-			return
+	switch c.policy {
+	case dropOldest:
+		select {
+		case <-c.send:
+		default:
+		}
+		select {
+		case c.send <- e:
+		default:
 		}
+		c.dropped.Add(1)
+	case dropNewest:
+		c.dropped.Add(1)
+	default:
+		c.dropped.Add(1)
+		log.Printf("hub client %d is too slow, disconnecting", c.id)
+		h.remove(c, "slow consumer: send buffer full")
 	}
+}
 
-	for key, value := range options {
-		message[key] = value
+// remove unregisters c and closes its send channel; reason is passed on to the client's close frame.
+// Its drop notice is queued rather than published, as remove runs in the middle of a publish.
+func (h *Hub) remove(c *Client, reason string) {
+	c.closeReason = reason
+	delete(h.clients, c)
+	close(c.send)
+	if c.dropped.Load() > h.reported[c] {
+		h.pending = append(h.pending, h.dropEvent(c))
 	}
+	delete(h.reported, c)
+}
 
+// reportDrops announces clients that dropped messages since the last report.
+func (h *Hub) reportDrops() {
+	for c := range h.clients {
+		if c.dropped.Load() > h.reported[c] {
+			h.publish(h.dropEvent(c))
+		}
+	}
+	if n := h.dropped.Swap(0); n > 0 {
+		message := map[string]any{
+			"type":    "hub backpressure",
+			"message": fmt.Sprintf("Hub dropped %d events, broadcast queue full", n),
+			"time":    time.Now().Format("2006-01-02 15:04:05.000"),
+			"dropped": n,
+		}
+		payload, _ := json.Marshal(message)
+		h.publish(&hubEvent{messageType: "hub backpressure", payload: payload})
+	}
+}
+
+func (h *Hub) dropEvent(c *Client) *hubEvent {
+	dropped := c.dropped.Load()
+	since := dropped - h.reported[c]
+	h.reported[c] = dropped
+
+	message := map[string]any{
+		"type":     "hub backpressure",
+		"message":  fmt.Sprintf("Client %d dropped %d events (%s)", c.id, since, c.policy),
+		"time":     time.Now().Format("2006-01-02 15:04:05.000"),
+		"clientId": c.id,
+		"policy":   c.policy,
+		"dropped":  dropped,
+	}
 	payload, _ := json.Marshal(message)
-	h.broadcast <- payload
+	return &hubEvent{messageType: "hub backpressure", payload: payload}
+}
+
+// publish numbers e, records it and fans it out from inside the Run goroutine.
+func (h *Hub) publish(e *hubEvent) {
+	h.nextId++
+	e.id = h.nextId
+	h.history = append(h.history, e)
+	if len(h.history) > historySize {
+		h.history = h.history[len(h.history)-historySize:]
+	}
+	for c := range h.clients {
+		if c.filter.match(e) {
+			h.deliver(c, e)
+		}
+	}
+}
+
+func (h *Hub) snapshot() []ClientStats {
+	out := make([]ClientStats, 0, len(h.clients))
+	for c := range h.clients {
+		out = append(out, ClientStats{
+			Id:       c.id,
+			Kind:     c.kind,
+			Policy:   c.policy,
+			Buffer:   cap(c.send),
+			Queued:   len(c.send),
+			Dropped:  c.dropped.Load(),
+			Types:    c.filter.types,
+			Elements: c.filter.elements,
+		})
+	}
+	slices.SortFunc(out, func(a, b ClientStats) int { return int(a.Id) - int(b.Id) })
+	return out
+}
+
+// Broadcast sends a message to all connected clients.
+// If includeTime is not provided, it defaults to true.
+func (h *Hub) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	message, err := broadcast.NewMessage(msg, messageType, includeTime, options)
+	if err != nil {
+		log.Printf("error - %v", err)
+		return
+	}
+
+	payload, _ := json.Marshal(message)
+	element, _ := options["element"].(string)
+	e := &hubEvent{
+		messageType: messageType,
+		element:     element,
+		payload:     payload,
+	}
+
+	// never block the pipeline on the hub
+	select {
+	case h.broadcast <- e:
+	default:
+		h.dropped.Add(1)
+	}
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"pokemonSightingApp/cmd/internal/config"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startHub(t *testing.T) *Hub {
+	t.Helper()
+	h := NewHub(config.Default().Hub)
+	go h.Run()
+	return h
+}
+
+// receive reads the next event sent to c, failing after a second.
+func receive(t *testing.T, c *Client) *hubEvent {
+	t.Helper()
+	select {
+	case e, ok := <-c.send:
+		if !ok {
+			t.Fatal("client was closed")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event within a second")
+	}
+	return nil
+}
+
+func messageOf(t *testing.T, e *hubEvent) string {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal(e.payload, &m); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ := m["message"].(string)
+	return msg
+}
+
+// waitDropped polls the hub until a client reports dropped events.
+func waitDropped(t *testing.T, h *Hub, dropped uint64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		for _, s := range h.ClientStats() {
+			if s.Dropped == dropped {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no client dropped %d events: %+v", dropped, h.ClientStats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHubRegisterAndPublish(t *testing.T) {
+	h := startHub(t)
+	all := newHubClient("test", eventFilter{}, 0, disconnect, 16)
+	fire := newHubClient("test", eventFilter{elements: []string{"fire"}}, 0, disconnect, 16)
+	h.register <- all
+	h.register <- fire
+	if e := receive(t, all); e.messageType != "register" {
+		t.Fatalf("first event = %q, want register", e.messageType)
+	}
+	receive(t, fire)
+	if n := h.GetLiveCount(); n != 2 {
+		t.Fatalf("live count = %d, want 2", n)
+	}
+
+	h.Broadcast("one", "pokemon capture", true, map[string]any{"element": "water"})
+	h.Broadcast("two", "pokemon capture", true, map[string]any{"element": "fire"})
+
+	first, second := receive(t, all), receive(t, all)
+	if messageOf(t, first) != "one" || messageOf(t, second) != "two" || first.id >= second.id {
+		t.Errorf("got %q (%d), %q (%d)", messageOf(t, first), first.id, messageOf(t, second), second.id)
+	}
+	if e := receive(t, fire); messageOf(t, e) != "two" {
+		t.Errorf("filtered client got %q", messageOf(t, e))
+	}
+
+	h.unregister <- fire
+	if _, ok := <-fire.send; ok {
+		t.Error("unregistered client still open")
+	}
+	if n := h.GetLiveCount(); n != 1 {
+		t.Errorf("live count = %d, want 1", n)
+	}
+}
+
+func TestHubReplaysFromLastEventId(t *testing.T) {
+	h := startHub(t)
+	watcher := newHubClient("test", eventFilter{}, 0, disconnect, 16)
+	h.register <- watcher
+	receive(t, watcher)
+	for i := range 3 {
+		h.Broadcast(fmt.Sprint(i), "agent log", true, nil)
+	}
+	first := receive(t, watcher)
+	receive(t, watcher)
+	receive(t, watcher)
+
+	resumed := newHubClient("test", eventFilter{}, first.id, disconnect, 16)
+	h.register <- resumed
+	receive(t, resumed)
+	if a, b := messageOf(t, receive(t, resumed)), messageOf(t, receive(t, resumed)); a != "1" || b != "2" {
+		t.Errorf("replayed %q, %q, want 1, 2", a, b)
+	}
+}
+
+func TestHubDropPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy slowConsumerPolicy
+		want   []string
+	}{
+		{dropOldest, []string{"2", "3"}},
+		{dropNewest, []string{"register", "1"}},
+	} {
+		t.Run(string(tc.policy), func(t *testing.T) {
+			h := startHub(t)
+			// the register event takes the first of two slots
+			c := newHubClient("test", eventFilter{}, 0, tc.policy, 2)
+			h.register <- c
+			for i := 1; i <= 3; i++ {
+				h.Broadcast(fmt.Sprint(i), "agent log", true, nil)
+			}
+			waitDropped(t, h, 2)
+
+			var got []string
+			for range 2 {
+				e := receive(t, c)
+				if e.messageType == "register" {
+					got = append(got, "register")
+				} else {
+					got = append(got, messageOf(t, e))
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("queued %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHubDisconnectsSlowClients(t *testing.T) {
+	h := startHub(t)
+	watcher := newHubClient("test", eventFilter{}, 0, disconnect, 64)
+	h.register <- watcher
+	receive(t, watcher)
+
+	// two slow clients fall behind on the same event; each drop notice is
+	// published after it, and after the other's, without recursing
+	var slow []*Client
+	for range 2 {
+		c := newHubClient("test", eventFilter{}, 0, disconnect, 1)
+		h.register <- c
+		slow = append(slow, c)
+	}
+	h.Broadcast("overflow", "agent log", true, nil)
+
+	e := receive(t, watcher)
+	if messageOf(t, e) != "overflow" {
+		t.Fatalf("got %q first", messageOf(t, e))
+	}
+	last := e.id
+	for range 2 {
+		notice := receive(t, watcher)
+		if notice.messageType != "hub backpressure" {
+			t.Fatalf("got %q, want a hub backpressure notice", notice.messageType)
+		}
+		if notice.id <= last {
+			t.Errorf("notice id %d is not after %d", notice.id, last)
+		}
+		last = notice.id
+	}
+
+	for _, c := range slow {
+		// the register event is still queued
+		<-c.send
+		if _, ok := <-c.send; ok {
+			t.Error("slow client still open")
+		}
+		if c.closeReason == "" {
+			t.Error("slow client closed without a reason")
+		}
+	}
+	if n := h.GetLiveCount(); n != 1 {
+		t.Errorf("live count = %d, want 1", n)
+	}
+
+	// a client resuming from the event it last saw gets the notices
+	resumed := newHubClient("test", eventFilter{types: []string{"hub backpressure"}}, e.id, disconnect, 16)
+	h.register <- resumed
+	receive(t, resumed)
+	receive(t, resumed)
+	receive(t, resumed)
+}
+
+func TestHubConcurrentClients(t *testing.T) {
+	h := startHub(t)
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				h.Broadcast(fmt.Sprint(i, j), "agent log", true, map[string]any{"element": "fire"})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			c := newHubClient("test", eventFilter{}, 0, []slowConsumerPolicy{dropOldest, dropNewest, disconnect}[i%3], 4)
+			h.register <- c
+			h.ClientStats()
+			h.unregister <- c
+			for range c.send {
+			}
+		}()
+	}
+	wg.Wait()
+	if n := h.GetLiveCount(); n != 0 {
+		t.Errorf("live count = %d, want 0", n)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/idempotency"
+	"pokemonSightingApp/cmd/service"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+const maxIdempotencyKey = 255
+
+// idempotent replays the first successful response for a repeated Idempotency-Key header.
+// Keys are scoped to the caller, and reusing one with a different body is a 409.
+func (app *Config) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeError(w, r, http.StatusBadRequest, codeValidation, "request failed validation",
+				service.FieldError{Field: "Idempotency-Key", Message: fmt.Sprintf("must be at most %d characters", maxIdempotencyKey)})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "failed to read request body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		scoped := clientKey(r) + "|" + r.Method + " " + r.URL.Path + "|" + key
+		stored, err := app.idempotency.Begin(scoped, hex.EncodeToString(sum[:]))
+		switch {
+		case errors.Is(err, idempotency.ErrMismatch), errors.Is(err, idempotency.ErrInFlight):
+			writeError(w, r, http.StatusConflict, codeConflict, err.Error())
+			return
+		case stored != nil:
+			for k, v := range stored.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		// release the key unless a response was stored, so that a failed or
+		// panicking request can be retried with the same key
+		completed := false
+		defer func() {
+			if !completed {
+				app.idempotency.Release(scoped)
+			}
+		}()
+
+		var buf bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&buf)
+		next.ServeHTTP(ww, r)
+
+		// only successes are final: rate limits, quota and validation errors
+		// and server errors may all go through on a retry
+		if ww.Status() < 200 || ww.Status() >= http.StatusMultipleChoices {
+			return
+		}
+		app.idempotency.Complete(scoped, &idempotency.Response{
+			Status: ww.Status(),
+			Header: w.Header().Clone(),
+			Body:   buf.Bytes(),
+		})
+		completed = true
+	})
+}
+
+// cleanupIdempotency periodically drops expired idempotency keys.
+func (app *Config) cleanupIdempotency() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		app.idempotency.Cleanup()
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"pokemonSightingApp/cmd/internal/idempotency"
+	"strings"
+	"testing"
+	"time"
+)
+
+func idempotentRequest(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/sightings", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotentCachesOnlySuccesses(t *testing.T) {
+	app := &Config{idempotency: idempotency.NewStore(time.Hour)}
+	statuses := []int{http.StatusTooManyRequests, http.StatusBadRequest, http.StatusInternalServerError, http.StatusCreated}
+	calls := 0
+	h := app.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(statuses[calls])
+		w.Write([]byte{byte('a' + calls)})
+		calls++
+	}))
+
+	for _, want := range statuses {
+		rec := idempotentRequest(h, "k1", "{}")
+		if rec.Code != want || rec.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("status = %d (replayed %q), want a fresh %d", rec.Code, rec.Header().Get("Idempotent-Replayed"), want)
+		}
+	}
+
+	rec := idempotentRequest(h, "k1", "{}")
+	if rec.Code != http.StatusCreated || rec.Body.String() != "d" || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("replay = %d %q, replayed %q", rec.Code, rec.Body.String(), rec.Header().Get("Idempotent-Replayed"))
+	}
+	if calls != len(statuses) {
+		t.Errorf("handler ran %d times, want %d", calls, len(statuses))
+	}
+
+	if rec := idempotentRequest(h, "k1", `{"other":true}`); rec.Code != http.StatusConflict {
+		t.Errorf("reused key with a different body = %d, want 409", rec.Code)
+	}
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	app := &Config{idempotency: idempotency.NewStore(time.Hour)}
+	panics := true
+	h := app.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panics {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("handler did not panic")
+			}
+		}()
+		idempotentRequest(h, "k1", "{}")
+	}()
+
+	panics = false
+	if rec := idempotentRequest(h, "k1", "{}"); rec.Code != http.StatusCreated {
+		t.Errorf("retry after a panic = %d, want 201", rec.Code)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/leaderboard"
+	"pokemonSightingApp/cmd/service"
+	"strings"
+	"time"
+)
+
+type AgentLeaderboardPayload struct {
+	Window string                   `json:"window"`
+	From   time.Time                `json:"from,omitzero"`
+	Agents []leaderboard.AgentScore `json:"agents"`
+}
+
+type TeamLeaderboardPayload struct {
+	Window string                  `json:"window"`
+	From   time.Time               `json:"from,omitzero"`
+	Teams  []leaderboard.TeamScore `json:"teams"`
+}
+
+// updateLeaderboard announces ranking changes to the broadcaster and saves the
+// scores every leaderboard.interval.
+func (app *Config) updateLeaderboard() {
+	ticker := time.NewTicker(app.cfg.Leaderboard.Interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		app.leaderboard.Announce(app.broadcaster)
+		if err := app.leaderboard.Save(); err != nil {
+			log.Println("leaderboard:", err)
+		}
+	}
+}
+
+// leaderboardWindow reads ?window=, all by default.
+func leaderboardWindow(w http.ResponseWriter, r *http.Request) (string, bool) {
+	window := r.URL.Query().Get("window")
+	if window == "" {
+		return leaderboard.All, true
+	}
+	for _, known := range leaderboard.Windows {
+		if window == known {
+			return window, true
+		}
+	}
+	writeError(w, r, http.StatusBadRequest, codeValidation, "request failed validation", service.FieldError{
+		Field:   "window",
+		Message: "must be one of " + strings.Join(leaderboard.Windows, ", "),
+	})
+	return "", false
+}
+
+// GetAgentLeaderboard serves GET /v1/leaderboard/agents?window=.
+func (app *Config) GetAgentLeaderboard(w http.ResponseWriter, r *http.Request) {
+	window, ok := leaderboardWindow(w, r)
+	if !ok {
+		return
+	}
+	agents, _ := app.leaderboard.Agents(window)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(AgentLeaderboardPayload{Window: window, From: leaderboard.From(window, time.Now()), Agents: agents})
+	w.Write(out)
+}
+
+// GetTeamLeaderboard serves GET /v1/leaderboard/teams?window=.
+func (app *Config) GetTeamLeaderboard(w http.ResponseWriter, r *http.Request) {
+	window, ok := leaderboardWindow(w, r)
+	if !ok {
+		return
+	}
+	teams, _ := app.leaderboard.Teams(window)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(TeamLeaderboardPayload{Window: window, From: leaderboard.From(window, time.Now()), Teams: teams})
+	w.Write(out)
+}
@@ -1,48 +1,238 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/alert"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/config"
+	"pokemonSightingApp/cmd/internal/history"
+	"pokemonSightingApp/cmd/internal/idempotency"
+	"pokemonSightingApp/cmd/internal/leaderboard"
+	"pokemonSightingApp/cmd/internal/openapi"
+	"pokemonSightingApp/cmd/internal/rabbitmgmt"
+	"pokemonSightingApp/cmd/internal/ratelimit"
+	"pokemonSightingApp/cmd/internal/webhook"
+	"pokemonSightingApp/cmd/service"
+	"syscall"
+	"time"
 
+	"github.com/go-chi/chi/v5"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-const webPort = "3000"
-
 type Config struct {
-	rabbitConn *amqp.Connection
-	hub        *Hub
+	cfg         config.Config
+	rabbitConn  *amqp.Connection
+	hub         *Hub
+	broadcaster broadcast.Broadcaster
+	webhooks    *webhook.Manager
+	service     *service.Service
+	spec        *openapi.Document
+	bus         *event.Consumer
+	auth        *auth.Authenticator
+	limiter     *ratelimit.Limiter
+	idempotency *idempotency.Store
+	history     *history.Store
+	alerts      *alert.Engine
+	sla         *event.SLATracker
+	leaderboard *leaderboard.Board
 }
 
 func main() {
+	cfg, err := config.Load("api", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	log.Printf("Configuration:\n%s", cfg.Redacted())
+	rules, err := alert.ParseRules(cfg.Alerts.Rules, service.SampledMetrics(event.TopologyOf(cfg.Broker).Queues()))
+	if err != nil {
+		log.Fatalf("invalid configuration: alerts.rules: %v", err)
+	}
+
+	app := Config{
+		cfg:     cfg,
+		limiter: ratelimit.NewLimiter(ratelimit.DefaultLimits()),
+	}
+	go app.cleanupLimiter()
+
+	spec, err := loadSpec()
+	if err != nil {
+		log.Panic(err)
+	}
+	app.spec = spec
 
-	app := Config{}
+	app.idempotency = idempotency.NewStore(cfg.Idempotency.Window)
+	go app.cleanupIdempotency()
+	if err := app.setupAuth(); err != nil {
+		log.Panic(err)
+	}
 	app.connect()
 
-	app.hub = NewHub()
+	app.hub = NewHub(cfg.Hub)
 	go app.hub.Run()
+	app.setupBroadcaster()
 
-	event.DispatchSetup(app.rabbitConn, "RocketHeadQuater", []string{"pokemon.sighting.#"}, app.hub)
-	event.DLQSetup(app.rabbitConn, app.hub)
+	captures := &event.CaptureCounter{}
+	escapes := &event.EscapeCounter{}
+	ages := &event.TaskAges{}
+	components := event.NewComponents()
+	app.sla = event.NewSLATracker(cfg.SLA.Retention, cfg.SLA.MaxTasks)
+	fleet := event.NewFleet(cfg.Agent.StaleAfter, cfg.Agent.DeadAfter)
+	app.setupLeaderboard()
+	fleet.Reserve(app.leaderboard.MaxAgentId())
+	app.service = service.New(service.NewRabbitBroker(app.rabbitConn, app.topology(), app.management()), app.broadcaster, fleet, escapes, service.Options{
+		Exchange:        cfg.Broker.Exchange,
+		ControlExchange: cfg.Broker.ControlExchange,
+		Queues:          app.topology().Queues(),
+		MinCaptureTime:  cfg.Capture.MinTime,
+		MaxCaptureTime:  cfg.Capture.MaxTime,
+	})
+	go app.sweepAgents(fleet)
 
-	serv := &http.Server{
-		Addr:    fmt.Sprintf(":%s", webPort),
-		Handler: app.routes(),
+	// the dispatcher, DLQ logger and agents run in their own binaries and report over the event bus
+	app.bus, err = event.BusSetup(app.rabbitConn, app.topology(), event.BusState{
+		Fleet:       fleet,
+		Components:  components,
+		Captures:    captures,
+		Escapes:     escapes,
+		Ages:        ages,
+		Merges:      &event.MergedReporters{},
+		SLA:         app.sla,
+		Leaderboard: app.leaderboard,
+	}, app.broadcaster)
+	if err != nil {
+		log.Println("event bus:", err)
 	}
 
-	err := serv.ListenAndServe()
-	if err != nil {
-		log.Panic(err)
+	app.setupHistory()
+	go service.NewSampler(app.service, app.history, captures, components, cfg.History.Interval).Run(context.Background())
+	app.alerts = alert.NewEngine(rules)
+	go app.evaluateAlerts()
+	go app.updateLeaderboard()
+
+	if cfg.Autoscale.Enabled {
+		scaler := service.NewAutoscaler(app.service, ages, service.AutoscaleOptions{
+			TaskQueue:         cfg.Broker.TaskQueue,
+			Interval:          cfg.Autoscale.Interval,
+			MinAgents:         cfg.Autoscale.MinAgents,
+			MaxAgents:         cfg.Autoscale.MaxAgents,
+			BacklogPerAgent:   cfg.Autoscale.BacklogPerAgent,
+			MaxTaskAge:        cfg.Autoscale.MaxTaskAge,
+			MaxEscapeRate:     cfg.Autoscale.MaxEscapeRate,
+			ScaleUpCooldown:   cfg.Autoscale.ScaleUpCooldown,
+			ScaleDownCooldown: cfg.Autoscale.ScaleDownCooldown,
+			AgentName:         cfg.Autoscale.AgentName,
+		})
+		go scaler.Run(context.Background())
+	}
+
+	grpcServer := app.newGRPCServer()
+	go func() {
+		if err := serveGRPC(grpcServer, cfg.GRPC.Port); err != nil {
+			log.Panic(err)
+		}
+	}()
+
+	routes := app.routes()
+	for _, d := range specDrift(app.spec, routes.(chi.Routes)) {
+		log.Printf("openapi: %s", d)
 	}
+
+	serv := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.HTTP.Port),
+		Handler: routes,
+	}
+
+	go func() {
+		err := serv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Panic(err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	app.shutdown(serv, grpcServer)
 }
 
 func (app *Config) connect() {
-	conn, err := event.RabbitMQConnect()
+	conn, err := event.RabbitMQConnect(app.cfg.Broker.URL)
 	if err != nil {
 		log.Panic(err)
 	}
 	app.rabbitConn = conn
 	log.Println("Connected to RabbitMQ!")
 }
+
+// management returns the management API client, nil when none is configured.
+func (app *Config) management() *rabbitmgmt.Client {
+	if app.cfg.Broker.ManagementURL == "" {
+		return nil
+	}
+	mgmt, err := rabbitmgmt.NewClient(app.cfg.Broker.ManagementURL, app.cfg.Broker.URL, 5*time.Second)
+	if err != nil {
+		log.Printf("queue stats fall back to passive declares: %v", err)
+		return nil
+	}
+	return mgmt
+}
+
+// setupHistory keeps history.retention worth of samples, in history.file when one is set.
+func (app *Config) setupHistory() {
+	capacity := int(app.cfg.History.Retention / app.cfg.History.Interval)
+	app.history = history.NewStore(capacity)
+	if app.cfg.History.File == "" {
+		return
+	}
+	store, err := history.Open(app.cfg.History.File, capacity)
+	if err != nil {
+		log.Printf("history kept in memory only: %v", err)
+		return
+	}
+	app.history = store
+}
+
+// setupLeaderboard loads the scores from leaderboard.file, keeping them in
+// memory only when there is none or it cannot be read.
+func (app *Config) setupLeaderboard() {
+	opts := leaderboard.Options{Rare: app.cfg.Leaderboard.RarePokemon, File: app.cfg.Leaderboard.File}
+	board, err := leaderboard.Open(opts)
+	if err != nil {
+		log.Printf("leaderboard kept in memory only: %v", err)
+		opts.File = ""
+		board, _ = leaderboard.Open(opts)
+	}
+	app.leaderboard = board
+}
+
+func (app *Config) topology() event.Topology {
+	return event.TopologyOf(app.cfg.Broker)
+}
+
+// sweepAgents marks agents that stopped sending heartbeats stale, then dead,
+// and tells the workers of the dead ones to reap them.
+func (app *Config) sweepAgents(fleet *event.Fleet) {
+	ticker := time.NewTicker(app.cfg.Agent.HeartbeatInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		for _, a := range fleet.Sweep(app.broadcaster) {
+			if err := app.service.ReapAgent(context.Background(), a); err != nil {
+				log.Printf("failed to ask worker %s to reap agent %d: %v", a.Worker, a.Id, err)
+			}
+		}
+	}
+}
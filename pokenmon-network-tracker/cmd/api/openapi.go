@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"pokemonSightingApp/api"
+	"pokemonSightingApp/cmd/internal/openapi"
+	"pokemonSightingApp/cmd/service"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxCapturedResponse bounds how much of a JSON response is kept for validation.
+const maxCapturedResponse = 1 << 20
+
+func loadSpec() (*openapi.Document, error) {
+	return openapi.Load(api.Spec)
+}
+
+// validateOpenAPI rejects requests whose parameters or JSON body do not match
+// openapi.yml and logs responses that stray from it. Routes the document does
+// not describe pass through untouched.
+func (app *Config) validateOpenAPI(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		op, params, ok := app.spec.Find(r.Method, r.URL.Path)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		fields := fieldErrors(op.ValidateParameters(r, params))
+
+		if op.RequestBody != nil && (op.RequestBody.Required || r.ContentLength > 0) {
+			name, mt, found := op.RequestBodyType(r.Header.Get("Content-Type"))
+			if !found {
+				writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia,
+					fmt.Sprintf("Content-Type must be one of %s", strings.Join(op.RequestBodyTypes(), ", ")))
+				return
+			}
+			if isJSON(name) && mt.Schema != nil {
+				body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1048576))
+				if err != nil {
+					writeError(w, r, http.StatusRequestEntityTooLarge, codeInvalidRequest, "request body must be at most one megabyte")
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				if len(bytes.TrimSpace(body)) == 0 {
+					fields = append(fields, service.FieldError{Field: "body", Message: "is required"})
+				} else {
+					fields = append(fields, fieldErrors(openapi.ValidateJSON(mt.Schema, body, openapi.InRequest))...)
+				}
+			}
+		}
+
+		if len(fields) > 0 {
+			writeError(w, r, http.StatusBadRequest, codeValidation, "request failed validation", fields...)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		capture := &jsonCapture{header: ww.Header()}
+		ww.Tee(capture)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 || status == http.StatusSwitchingProtocols {
+			return
+		}
+		mt, hasSchema, declared := op.ResponseType(status, ww.Header().Get("Content-Type"))
+		reqId := middleware.GetReqID(r.Context())
+		if !declared {
+			log.Printf("openapi: %s %s returned undocumented status %d (request %s)", r.Method, r.URL.Path, status, reqId)
+			return
+		}
+		if !hasSchema || !capture.ok() {
+			return
+		}
+		for _, f := range openapi.ValidateJSON(mt.Schema, capture.buf.Bytes(), openapi.InResponse) {
+			log.Printf("openapi: %s %s response %d does not match the spec: %s (request %s)", r.Method, r.URL.Path, status, f, reqId)
+		}
+	})
+}
+
+func fieldErrors(errs []openapi.FieldError) []service.FieldError {
+	out := make([]service.FieldError, 0, len(errs))
+	for _, e := range errs {
+		field := e.Field
+		if field == "" {
+			field = "body"
+		}
+		out = append(out, service.FieldError{Field: field, Message: e.Message})
+	}
+	return out
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonCapture keeps a copy of a JSON response body for validation. Other
+// content types, and bodies past maxCapturedResponse, are not kept.
+type jsonCapture struct {
+	header   http.Header
+	buf      bytes.Buffer
+	decided  bool
+	keep     bool
+	overflow bool
+}
+
+func (c *jsonCapture) Write(p []byte) (int, error) {
+	if !c.decided {
+		c.decided = true
+		media, _, _ := mime.ParseMediaType(c.header.Get("Content-Type"))
+		c.keep = isJSON(media)
+	}
+	if c.keep && !c.overflow {
+		if c.buf.Len()+len(p) > maxCapturedResponse {
+			c.overflow = true
+			c.buf.Reset()
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *jsonCapture) ok() bool {
+	return c.keep && !c.overflow && c.buf.Len() > 0
+}
+
+// specDrift lists routes served by the router but missing from openapi.yml,
+// and operations in openapi.yml that nothing serves.
+func specDrift(spec *openapi.Document, routes chi.Routes) []string {
+	var drift []string
+	served := map[string]bool{}
+	chi.Walk(routes, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		route = strings.TrimSuffix(strings.ReplaceAll(route, "/*/", "/"), "/*")
+		served[method+" "+route] = true
+		if !spec.Has(method, route) {
+			drift = append(drift, fmt.Sprintf("%s %s is served but not documented", method, route))
+		}
+		return nil
+	})
+	for _, op := range spec.Operations() {
+		if !served[op] {
+			drift = append(drift, fmt.Sprintf("%s is documented but not served", op))
+		}
+	}
+	return drift
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateOpenAPI(t *testing.T) {
+	spec, err := loadSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &Config{spec: spec}
+	h := app.validateOpenAPI(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		headers     map[string]string
+		want        int
+		fields      []string
+	}{
+		{"valid sighting", "POST", "/v1/sightings", "application/json", `{"pokemon":"Charmander","location":"Route 24","element":"fire"}`, nil, http.StatusNoContent, nil},
+		{"missing fields", "POST", "/v1/sightings", "application/json", `{"pokemon":"Charmander"}`, nil, http.StatusBadRequest, []string{"location", "element"}},
+		{"unknown element", "POST", "/v1/sightings", "application/json", `{"pokemon":"Pikachu","location":"Route 24","element":"electric"}`, nil, http.StatusBadRequest, []string{"element"}},
+		{"wrong type", "POST", "/v1/sightings", "application/json", `{"pokemon":7,"location":"Route 24","element":"fire"}`, nil, http.StatusBadRequest, []string{"pokemon"}},
+		{"empty body", "POST", "/v1/sightings", "application/json", ``, nil, http.StatusBadRequest, []string{"body"}},
+		{"malformed body", "POST", "/v1/sightings", "application/json", `{"pokemon":`, nil, http.StatusBadRequest, []string{"body"}},
+		{"unsupported media type", "POST", "/v1/sightings", "text/plain", `pokemon=Charmander`, nil, http.StatusUnsupportedMediaType, nil},
+		{"legacy route", "POST", "/sighting", "application/json", `{"pokemon":"Charmander"}`, nil, http.StatusBadRequest, []string{"location", "element"}},
+		{"valid agent", "POST", "/v1/agents", "application/json", `{"name":"Jessie","imageNum":2}`, nil, http.StatusNoContent, nil},
+		{"idempotency key too long", "POST", "/v1/sightings", "application/json", `{"pokemon":"Charmander","location":"Route 24","element":"fire"}`, map[string]string{"Idempotency-Key": strings.Repeat("k", 256)}, http.StatusBadRequest, []string{"Idempotency-Key"}},
+		{"undocumented route", "GET", "/v1/nothing-here", "", ``, nil, http.StatusNoContent, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			for name, value := range tc.headers {
+				req.Header.Set(name, value)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.want, rec.Body)
+			}
+			if tc.fields == nil {
+				return
+			}
+
+			var body ErrorPayload
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range body.Fields {
+				got = append(got, f.Field)
+			}
+			if body.Code != codeValidation || strings.Join(got, ",") != strings.Join(tc.fields, ",") {
+				t.Errorf("error %s with fields %v, want %s with %v", body.Code, got, codeValidation, tc.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/ratelimit"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// rateLimit applies the per-route token bucket, keyed by the caller's
+// credential when authenticated and by client IP otherwise.
+func (app *Config) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := app.limiter.Allow(routeKey(r), clientKey(r))
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sightingQuota enforces the daily sighting quota of the caller's team.
+// Only accepted sightings count against the quota.
+func (app *Config) sightingQuota(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, _ := auth.FromContext(r.Context())
+		if p.Team == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		charge, ok := app.limiter.UseQuota(p.Team)
+		if charge.Remaining >= 0 {
+			w.Header().Set("X-Quota-Remaining", strconv.Itoa(charge.Remaining))
+		}
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(charge.Reset).Seconds()))))
+			writeError(w, r, http.StatusTooManyRequests, codeQuotaExceeded, fmt.Sprintf("daily sighting quota exceeded for team %s", p.Team))
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		if ww.Status() >= http.StatusMultipleChoices {
+			app.limiter.Refund(charge)
+		}
+	})
+}
+
+func clientKey(r *http.Request) string {
+	return callerKey(r.Context(), r.RemoteAddr)
+}
+
+// callerKey names the caller by its credential when authenticated and by its address otherwise.
+func callerKey(ctx context.Context, remoteAddr string) string {
+	if p, ok := auth.FromContext(ctx); ok && p.Subject != "anonymous" {
+		return "sub:" + p.Subject
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return "ip:" + host
+}
+
+type LimitsPayload struct {
+	ratelimit.Limits
+	Usage map[string]int `json:"usage,omitempty"`
+}
+
+func (app *Config) GetLimits(w http.ResponseWriter, r *http.Request) {
+	p := LimitsPayload{Limits: app.limiter.Limits(), Usage: app.limiter.Usage()}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(p)
+	w.Write(out)
+}
+
+func (app *Config) UpdateLimits(w http.ResponseWriter, r *http.Request) {
+	var limits ratelimit.Limits
+	err := app.readJSON(w, r, &limits)
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	if err := app.limiter.SetLimits(limits); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+	app.GetLimits(w, r)
+}
+
+// cleanupLimiter periodically forgets idle client buckets.
+func (app *Config) cleanupLimiter() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for range ticker.C {
+		app.limiter.Cleanup(10 * time.Minute)
+	}
+}
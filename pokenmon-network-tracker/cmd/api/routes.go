@@ -1,7 +1,10 @@
 package main
 
 import (
+	"fmt"
 	"net/http"
+	"pokemonSightingApp/cmd/internal/auth"
+	"strings"
 
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/chi/v5"
@@ -12,37 +15,209 @@ func (app *Config) routes() http.Handler {
 	mux := chi.NewRouter()
 	// specify who is allowed to connect
 	mux.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"*"}, // allow all origins
-		AllowedMethods:   []string{"GET", "POST", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false, // required when using "*"
+		AllowOriginFunc:  app.allowOrigin,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-API-Key", "Last-Event-ID", "Idempotency-Key", "X-Request-Id"},
+		ExposedHeaders:   []string{"Link", "Retry-After", "X-Quota-Remaining", "Idempotent-Replayed", "X-Request-Id", "Deprecation"},
+		AllowCredentials: false, // credentials travel in headers, not cookies
 		MaxAge:           300,
 	}))
 
+	mux.Use(requestId)
 	mux.Use(middleware.Heartbeat("/ping"))
 
-	mux.Post("/sighting", app.SightingHandle)
+	// probes for container orchestration, open to anyone
+	mux.Get("/healthz", app.Healthz)
+	mux.Get("/readyz", app.Readyz)
 
-	mux.Post("/spawn/rocket-agent", app.SpawnRocketAgent)
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.authenticate)
+		mux.Use(app.rateLimit)
+		mux.Use(deprecated)
 
-	mux.Post("/spawn/team", app.SpawnTeam)
+		// reporters submit sightings
+		mux.Group(func(mux chi.Router) {
+			mux.Use(requireRole(auth.SightingReporter))
+			mux.Use(app.validateOpenAPI)
 
-	mux.Post("/state/queue", app.QueueStats)
+			mux.With(app.idempotent, app.sightingQuota).Post("/v1/sightings", app.CreateSighting)
 
-	// mux.Get("/state/logs", app.GetLogs)
+			mux.Post("/v1/sightings/bulk", app.CreateSightingsBulk)
 
-	mux.Get("/state/events", app.StreamEventWS)
+			mux.With(app.idempotent, app.sightingQuota).Post("/sighting", app.SightingHandle)
 
-	mux.Get("/reset/agents", app.ResetAgents)
+			mux.Post("/sightings/bulk", app.SightingsBulk)
+		})
 
-	mux.Get("/reset/system", app.ResetSystem)
+		// operators run the pipeline
+		mux.Group(func(mux chi.Router) {
+			mux.Use(requireRole(auth.Operator))
+			mux.Use(app.validateOpenAPI)
 
-	mux.Get("/state/dead-message", app.GetDLQTotalCount)
+			mux.Post("/v1/agents", app.CreateAgent)
 
-	mux.Get("/state/hub/active", app.GetWebsocketCount)
+			mux.Post("/v1/teams", app.CreateTeam)
 
-	mux.Get("/state/agents", app.GetAgentsState)
+			mux.Post("/v1/webhooks", app.CreateWebhook)
+
+			mux.Get("/v1/webhooks", app.ListWebhooks)
+
+			mux.Delete("/v1/webhooks/{id}", app.DeleteWebhook)
+
+			mux.Get("/v1/webhooks/{id}/deliveries", app.GetWebhookDeliveries)
+
+			mux.Post("/spawn/rocket-agent", app.SpawnRocketAgent)
+
+			mux.Post("/spawn/team", app.SpawnTeam)
+
+			mux.Post("/webhooks", app.CreateWebhook)
+
+			mux.Get("/webhooks", app.ListWebhooks)
+
+			mux.Delete("/webhooks/{id}", app.DeleteWebhook)
+
+			mux.Get("/webhooks/{id}/deliveries", app.GetWebhookDeliveries)
+		})
+
+		// only admins can tear things down
+		mux.Group(func(mux chi.Router) {
+			mux.Use(requireRole(auth.Admin))
+			mux.Use(app.validateOpenAPI)
+
+			mux.Delete("/v1/agents", app.ResetAgents)
+
+			mux.Post("/v1/admin/reset", app.ResetSystem)
+
+			mux.Get("/v1/admin/limits", app.GetLimits)
+
+			mux.Put("/v1/admin/limits", app.UpdateLimits)
+
+			mux.Get("/reset/agents", app.ResetAgents)
+
+			mux.Get("/reset/system", app.ResetSystem)
+
+			mux.Get("/admin/limits", app.GetLimits)
+
+			mux.Put("/admin/limits", app.UpdateLimits)
+		})
+
+		// every authenticated role can observe
+		mux.Group(func(mux chi.Router) {
+			mux.Use(requireRole(auth.Observer, auth.SightingReporter, auth.Operator))
+			mux.Use(app.validateOpenAPI)
+
+			mux.Get("/v1/agents", app.GetAgentsState)
+
+			mux.Get("/v1/workers", app.GetWorkers)
+
+			mux.Get("/v1/queues", app.GetQueues)
+
+			mux.Get("/v1/queues/{name}", app.GetQueue)
+
+			mux.Get("/v1/escapes", app.GetDLQTotalCount)
+
+			mux.Get("/v1/history", app.GetHistory)
+
+			mux.Get("/v1/alerts", app.GetAlerts)
+
+			mux.Get("/v1/sla", app.GetSLA)
+
+			mux.Get("/v1/leaderboard/agents", app.GetAgentLeaderboard)
+
+			mux.Get("/v1/leaderboard/teams", app.GetTeamLeaderboard)
+
+			mux.Get("/v1/hub/active", app.GetWebsocketCount)
+
+			mux.Get("/v1/hub/clients", app.GetHubClients)
+
+			mux.Get("/v1/events", app.StreamEventWS)
+
+			mux.Get("/v1/events/sse", app.StreamEventSSE)
+
+			mux.Post("/state/queue", app.QueueStats)
+
+			mux.Get("/state/queues", app.GetQueues)
+
+			mux.Get("/state/history", app.GetHistory)
+
+			// mux.Get("/state/logs", app.GetLogs)
+
+			mux.Get("/state/events", app.StreamEventWS)
+
+			mux.Get("/state/events/sse", app.StreamEventSSE)
+
+			mux.Get("/state/dead-message", app.GetDLQTotalCount)
+
+			mux.Get("/state/hub/active", app.GetWebsocketCount)
+
+			mux.Get("/state/hub/clients", app.GetHubClients)
+
+			mux.Get("/state/agents", app.GetAgentsState)
+		})
+	})
 
 	return mux
 }
+
+// allowOrigin checks origin against http.corsOrigins. An empty list allows no
+// cross-origin requests; "*" has to be configured explicitly.
+func (app *Config) allowOrigin(r *http.Request, origin string) bool {
+	for _, allowed := range app.cfg.HTTP.CORSOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyRoutes maps each unversioned route onto the /v1 route replacing it.
+var legacyRoutes = map[string]string{
+	"POST /sighting":                "POST /v1/sightings",
+	"POST /sightings/bulk":          "POST /v1/sightings/bulk",
+	"POST /spawn/rocket-agent":      "POST /v1/agents",
+	"POST /spawn/team":              "POST /v1/teams",
+	"POST /webhooks":                "POST /v1/webhooks",
+	"GET /webhooks":                 "GET /v1/webhooks",
+	"DELETE /webhooks/{id}":         "DELETE /v1/webhooks/{id}",
+	"GET /webhooks/{id}/deliveries": "GET /v1/webhooks/{id}/deliveries",
+	"GET /reset/agents":             "DELETE /v1/agents",
+	"GET /reset/system":             "POST /v1/admin/reset",
+	"GET /admin/limits":             "GET /v1/admin/limits",
+	"PUT /admin/limits":             "PUT /v1/admin/limits",
+	"POST /state/queue":             "GET /v1/queues/{name}",
+	"GET /state/queues":             "GET /v1/queues",
+	"GET /state/history":            "GET /v1/history",
+	"GET /state/agents":             "GET /v1/agents",
+	"GET /state/dead-message":       "GET /v1/escapes",
+	"GET /state/hub/active":         "GET /v1/hub/active",
+	"GET /state/hub/clients":        "GET /v1/hub/clients",
+	"GET /state/events":             "GET /v1/events",
+	"GET /state/events/sse":         "GET /v1/events/sse",
+}
+
+// routeKey names the matched route as "METHOD /pattern". Legacy aliases
+// resolve to their /v1 route so both share limits.
+func routeKey(r *http.Request) string {
+	key := r.Method + " " + r.URL.Path
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		key = r.Method + " " + rctx.RoutePattern()
+	}
+	if successor, ok := legacyRoutes[key]; ok {
+		return successor
+	}
+	return key
+}
+
+// deprecated marks responses from legacy routes with a Deprecation header
+// and a Link to the /v1 route that replaces them.
+func deprecated(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx := chi.RouteContext(r.Context())
+		if successor, ok := legacyRoutes[r.Method+" "+rctx.RoutePattern()]; ok {
+			_, path, _ := strings.Cut(successor, " ")
+			w.Header().Set("Deprecation", "true")
+			w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", path))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
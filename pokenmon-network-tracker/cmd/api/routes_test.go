@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"pokemonSightingApp/cmd/internal/config"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestLeaderboardIsOnlyVersioned(t *testing.T) {
+	app := &Config{cfg: config.Default()}
+	var leaderboards []string
+	err := chi.Walk(app.routes().(chi.Routes), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.Contains(route, "leaderboard") {
+			leaderboards = append(leaderboards, method+" "+route)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(leaderboards, ",") != "GET /v1/leaderboard/agents,GET /v1/leaderboard/teams" {
+		t.Errorf("leaderboard routes = %v", leaderboards)
+	}
+	for legacy := range legacyRoutes {
+		if strings.Contains(legacy, "leaderboard") {
+			t.Errorf("legacy route %s", legacy)
+		}
+	}
+}
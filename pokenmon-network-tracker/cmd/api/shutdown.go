@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"google.golang.org/grpc"
+)
+
+// shutdown stops the server in dependency order within http.shutdownTimeout:
+// refuse new work, stop consuming the event bus, close stream clients with
+// a reason, then stop the HTTP and gRPC servers, abandon pending webhook
+// deliveries and close the broker connection.
+// The dispatcher, DLQ logger and agent workers are separate processes and keep running.
+func (app *Config) shutdown(serv *http.Server, grpcServer *grpc.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), app.cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	log.Println("Shutting down...")
+
+	app.service.Shutdown(ctx)
+
+	if err := app.bus.Stop(ctx); err != nil {
+		log.Println("event bus:", err)
+	}
+
+	// closing the listener first keeps new streams from arriving while the hub closes the old ones
+	httpDone := make(chan error, 1)
+	go func() { httpDone <- serv.Shutdown(ctx) }()
+
+	if err := app.hub.Shutdown(ctx, "server shutting down"); err != nil {
+		log.Println("hub:", err)
+	}
+
+	grpcDone := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(grpcDone)
+	}()
+	select {
+	case <-grpcDone:
+	case <-ctx.Done():
+		grpcServer.Stop()
+	}
+
+	if err := <-httpDone; err != nil {
+		log.Println("http:", err)
+	}
+	app.webhooks.Close()
+
+	if app.rabbitConn != nil && !app.rabbitConn.IsClosed() {
+		if err := app.rabbitConn.Close(); err != nil {
+			log.Println("rabbitmq:", err)
+		}
+	}
+	if err := app.history.Close(); err != nil {
+		log.Println("history:", err)
+	}
+	if err := app.leaderboard.Save(); err != nil {
+		log.Println("leaderboard:", err)
+	}
+	log.Println("Shutdown complete")
+}
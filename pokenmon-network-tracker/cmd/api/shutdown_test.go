@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/config"
+	"pokemonSightingApp/cmd/internal/history"
+	"pokemonSightingApp/cmd/internal/leaderboard"
+	"pokemonSightingApp/cmd/internal/webhook"
+	"pokemonSightingApp/cmd/service"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+func TestShutdownWithoutBroker(t *testing.T) {
+	app := &Config{cfg: config.Default(), webhooks: webhook.NewManager(), history: history.NewStore(10)}
+	app.cfg.HTTP.ShutdownTimeout = time.Second
+	app.hub = NewHub(app.cfg.Hub)
+	go app.hub.Run()
+	app.service = service.New(&fakeBroker{}, app.hub, event.NewFleet(time.Minute, 2*time.Minute), &event.EscapeCounter{}, service.Options{})
+	board, err := leaderboard.Open(leaderboard.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.leaderboard = board
+
+	// never connected: rabbitConn and the event bus are nil
+	app.shutdown(&http.Server{}, grpc.NewServer())
+	if !app.service.Draining() {
+		t.Error("service still accepts work")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/ratelimit"
+	"pokemonSightingApp/cmd/service"
+	"slices"
+	"strings"
+)
+
+const (
+	maxBulkBytes     = 10 << 20 // ten megabytes
+	maxBulkRows      = 10000
+	maxBulkLineBytes = 1 << 20 // one megabyte, newline included
+)
+
+type BulkRow struct {
+	Line    int    `json:"line"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Pokemon string `json:"pokemon,omitempty"`
+}
+
+type BulkReport struct {
+	Accepted int       `json:"accepted"`
+	Rejected int       `json:"rejected"`
+	Rows     []BulkRow `json:"rows"`
+}
+
+func (b *BulkReport) accept(line int, s event.Sighting) {
+	b.Accepted++
+	b.Rows = append(b.Rows, BulkRow{Line: line, Status: "accepted", Pokemon: s.Pokemon})
+}
+
+func (b *BulkReport) reject(line int, pokemon string, reason string) {
+	b.Rejected++
+	b.Rows = append(b.Rows, BulkRow{Line: line, Status: "rejected", Reason: reason, Pokemon: pokemon})
+}
+
+type bulkLine struct {
+	line     int
+	sighting event.Sighting
+	err      error
+	// charge is refunded when the sighting could not be published
+	charge ratelimit.Charge
+}
+
+// SightingsBulk serves the deprecated POST /sightings/bulk.
+func (app *Config) SightingsBulk(w http.ResponseWriter, r *http.Request) {
+	app.bulkSightings(w, r, http.StatusOK)
+}
+
+func (app *Config) CreateSightingsBulk(w http.ResponseWriter, r *http.Request) {
+	app.bulkSightings(w, r, http.StatusAccepted)
+}
+
+// bulkSightings ingests an NDJSON (application/x-ndjson) or CSV (text/csv) upload.
+// Each line is validated on its own, valid sightings are published together,
+// and the response reports the outcome of every line.
+func (app *Config) bulkSightings(w http.ResponseWriter, r *http.Request, status int) {
+	if app.service.Draining() {
+		serviceError(w, r, service.ErrDraining, "")
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	body := http.MaxBytesReader(w, r.Body, maxBulkBytes)
+	var lines []bulkLine
+	var err error
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/json-seq":
+		lines, err = readNDJSON(body)
+	case "text/csv":
+		lines, err = readCSV(body)
+	default:
+		writeError(w, r, http.StatusUnsupportedMediaType, codeUnsupportedMedia, "Content-Type must be application/x-ndjson or text/csv")
+		return
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, r, http.StatusRequestEntityTooLarge, codeInvalidRequest, "upload must be at most ten megabytes")
+		return
+	}
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	report := BulkReport{Rows: make([]BulkRow, 0, len(lines))}
+	reporter := reporterFrom(r.Context())
+	principal, _ := auth.FromContext(r.Context())
+
+	var batch []bulkLine
+	for _, l := range lines {
+		if l.err == nil {
+			l.err = service.ValidateSighting(l.sighting)
+		}
+		if l.err != nil {
+			report.reject(l.line, l.sighting.Pokemon, l.err.Error())
+			continue
+		}
+		if principal.Team != "" {
+			charge, ok := app.limiter.UseQuota(principal.Team)
+			if !ok {
+				report.reject(l.line, l.sighting.Pokemon, "daily sighting quota exceeded")
+				continue
+			}
+			l.charge = charge
+		}
+		l.sighting.Reporter = reporter
+		batch = append(batch, l)
+	}
+
+	sightings := make([]event.Sighting, len(batch))
+	for i, l := range batch {
+		sightings[i] = l.sighting
+	}
+	_, errs := app.service.ReportSightings(r.Context(), sightings)
+	for i, l := range batch {
+		if errs[i] != nil {
+			log.Println(errs[i])
+			report.reject(l.line, l.sighting.Pokemon, "failed to publish sighting")
+			app.limiter.Refund(l.charge)
+			continue
+		}
+		report.accept(l.line, l.sighting)
+	}
+	slices.SortFunc(report.Rows, func(a, b BulkRow) int { return a.Line - b.Line })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	out, _ := json.Marshal(report)
+	w.Write(out)
+}
+
+// readNDJSON reads one sighting per line. A line longer than
+// maxBulkLineBytes is rejected on its own.
+func readNDJSON(r io.Reader) ([]bulkLine, error) {
+	var lines []bulkLine
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		raw, tooLong, err := readLine(br)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read upload: %w", err)
+		}
+		text := strings.TrimSpace(string(raw))
+		if text != "" || tooLong {
+			if len(lines) >= maxBulkRows {
+				return nil, fmt.Errorf("upload exceeds %d rows", maxBulkRows)
+			}
+			l := bulkLine{line: n}
+			if tooLong {
+				l.err = fmt.Errorf("line exceeds %d bytes", maxBulkLineBytes)
+			} else {
+				dec := json.NewDecoder(strings.NewReader(text))
+				dec.DisallowUnknownFields()
+				if err := dec.Decode(&l.sighting); err != nil {
+					l.err = fmt.Errorf("invalid JSON: %v", err)
+				}
+			}
+			lines = append(lines, l)
+		}
+		if err == io.EOF {
+			return lines, nil
+		}
+	}
+}
+
+// readLine returns the next line with its newline. Once the line passes
+// maxBulkLineBytes the rest of it is skipped and tooLong reported instead.
+func readLine(br *bufio.Reader) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := br.ReadSlice('\n')
+		if !tooLong && len(line)+len(chunk) > maxBulkLineBytes {
+			line, tooLong = nil, true
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+		}
+		if err != bufio.ErrBufferFull {
+			return line, tooLong, err
+		}
+	}
+}
+
+// readCSV expects a header row naming the pokemon, location and element columns, in any order.
+func readCSV(r io.Reader) ([]bulkLine, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"pokemon", "location", "element"} {
+		if _, ok := cols[name]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %q column", name)
+		}
+	}
+	field := func(record []string, name string) string {
+		if i := cols[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var lines []bulkLine
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if len(lines) >= maxBulkRows {
+			return nil, fmt.Errorf("upload exceeds %d rows", maxBulkRows)
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				lines = append(lines, bulkLine{line: perr.Line, err: fmt.Errorf("invalid CSV: %v", perr.Err)})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read upload: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+		l := bulkLine{line: line}
+		l.sighting.Pokemon = field(record, "pokemon")
+		l.sighting.Location = field(record, "location")
+		l.sighting.Element = strings.ToLower(field(record, "element"))
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/auth"
+	"pokemonSightingApp/cmd/internal/config"
+	"pokemonSightingApp/cmd/internal/ratelimit"
+	"pokemonSightingApp/cmd/service"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// outcome lists each line as "line:status:pokemon", e.g. "1:ok:Eevee,3:error:".
+func outcome(lines []bulkLine) string {
+	var out []string
+	for _, l := range lines {
+		status := "ok"
+		if l.err != nil {
+			status = "error"
+		}
+		out = append(out, strings.Join([]string{strconv.Itoa(l.line), status, l.sighting.Pokemon}, ":"))
+	}
+	return strings.Join(out, ",")
+}
+
+func TestReadNDJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", ""},
+		{"blank lines keep their numbers", "\n{\"pokemon\":\"Eevee\"}\n\n  \n{\"pokemon\":\"Mew\"}", "2:ok:Eevee,5:ok:Mew"},
+		{"invalid JSON", "{\"pokemon\":\"Eevee\"}\n{\"pokemon\":\n", "1:ok:Eevee,2:error:"},
+		{"unknown field", "{\"pokemon\":\"Eevee\",\"level\":5}\n", "1:error:Eevee"},
+		{"windows line endings", "{\"pokemon\":\"Eevee\"}\r\n{\"pokemon\":\"Mew\"}\r\n", "1:ok:Eevee,2:ok:Mew"},
+		{"line over the limit", "{\"pokemon\":\"Eevee\"}\n{\"pokemon\":\"" + strings.Repeat("x", maxBulkLineBytes) + "\"}\n{\"pokemon\":\"Mew\"}\n", "1:ok:Eevee,2:error:,3:ok:Mew"},
+		{"line at the limit", "{\"pokemon\":\"" + strings.Repeat("x", maxBulkLineBytes-16) + "\"}\n", "1:ok:" + strings.Repeat("x", maxBulkLineBytes-16)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := readNDJSON(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := outcome(lines); got != tt.want {
+				t.Errorf("lines = %.200s, want %.200s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := readNDJSON(strings.NewReader(strings.Repeat("{}\n", maxBulkRows+1))); err == nil {
+		t.Error("accepted more than maxBulkRows lines")
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr string
+	}{
+		{"columns in any order", "element,Location,POKEMON\nFire, Route 24 ,Charmander\n", "2:ok:Charmander", ""},
+		{"extra columns", "pokemon,trainer,location,element\nEevee,red,Route 1,normal\n", "2:ok:Eevee", ""},
+		{"short record", "pokemon,location,element\nEevee,Route 1\nMew,Route 2,psychic\n", "2:ok:Eevee,3:ok:Mew", ""},
+		{"bad quote", "pokemon,location,element\nEevee,Ro\"ute 1,normal\nMew,Route 2,psychic\n", "2:error:,3:ok:Mew", ""},
+		{"unterminated quote", "pokemon,location,element\n\"Eevee,Route 1,normal\nMew,Route 2,psychic\n", "3:error:", ""},
+		{"missing column", "pokemon,location\nEevee,Route 1\n", "", `missing the "element" column`},
+		{"no header", "", "", "failed to read CSV header"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := readCSV(strings.NewReader(tt.body))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := outcome(lines); got != tt.want {
+				t.Errorf("lines = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	lines, err := readCSV(strings.NewReader("pokemon,location,element\nEevee,Route 1,NORMAL\n"))
+	if err != nil || lines[0].sighting.Element != "normal" || lines[0].sighting.Location != "Route 1" {
+		t.Errorf("lines = %+v, %v", lines, err)
+	}
+}
+
+// bulkApp serves bulk uploads for team red with a daily quota of quota.
+func bulkApp(t *testing.T, quota int) (*Config, *fakeBroker) {
+	t.Helper()
+	limits := ratelimit.DefaultLimits()
+	limits.DailyQuota = quota
+	app := &Config{cfg: config.Default(), limiter: ratelimit.NewLimiter(limits)}
+	app.hub = NewHub(app.cfg.Hub)
+	go app.hub.Run()
+	broker := &fakeBroker{}
+	app.service = service.New(broker, app.hub, event.NewFleet(time.Minute, 2*time.Minute), &event.EscapeCounter{}, service.Options{
+		Exchange:       "pokemon_exchange",
+		MinCaptureTime: 5 * time.Second,
+		MaxCaptureTime: 5 * time.Second,
+	})
+	return app, broker
+}
+
+func upload(app *Config, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/v1/sightings/bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req = req.WithContext(auth.WithPrincipal(context.Background(), auth.Principal{Subject: "red", Role: auth.SightingReporter, Team: "red"}))
+	rec := httptest.NewRecorder()
+	app.CreateSightingsBulk(rec, req)
+	return rec
+}
+
+func TestBulkSightings(t *testing.T) {
+	const csv = "pokemon,location,element\n" +
+		"Charmander,Route 24,fire\n" +
+		"Pikachu,Route 1,electric\n" +
+		"Squirtle,Route 25,water\n" +
+		"Bulbasaur,Route 2,grass\n" +
+		"Eevee,Route 3,grass\n"
+
+	tests := []struct {
+		name  string
+		quota int
+		fail  int
+		// want lists the status of each data row, in order
+		want      string
+		published int
+		usage     int
+	}{
+		{"every line", 0, 0, "accepted,rejected,accepted,accepted,accepted", 4, 4},
+		{"quota runs out part way", 2, 0, "accepted,rejected,accepted,rejected,rejected", 2, 2},
+		{"failed publishes are refunded", 10, 2, "rejected,rejected,rejected,accepted,accepted", 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, broker := bulkApp(t, tt.quota)
+			broker.fail = tt.fail
+			rec := upload(app, "text/csv", csv)
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+			}
+			var report BulkReport
+			if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, row := range report.Rows {
+				got = append(got, row.Status)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("rows = %+v, want %s", report.Rows, tt.want)
+			}
+			if report.Rows[1].Reason == "" || report.Accepted+report.Rejected != 5 {
+				t.Errorf("report = %+v", report)
+			}
+			if broker.count() != tt.published {
+				t.Errorf("published %d, want %d", broker.count(), tt.published)
+			}
+			if tt.quota > 0 {
+				if usage := app.limiter.Usage()["red"]; usage != tt.usage {
+					t.Errorf("usage = %d, want %d", usage, tt.usage)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkSightingsTooLarge(t *testing.T) {
+	app, broker := bulkApp(t, 0)
+	body := `{"pokemon":"Eevee","location":"Route 1","element":"normal"}` + "\n" + strings.Repeat(" ", maxBulkBytes)
+	rec := upload(app, "application/x-ndjson", body)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status = %d, want 413: %.200s", rec.Code, rec.Body)
+	}
+	if broker.count() != 0 {
+		t.Errorf("published %d sightings from a refused upload", broker.count())
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/service"
+	"time"
+)
+
+type SLAPayload struct {
+	Window string `json:"window"`
+	event.SLAReport
+}
+
+// GetSLA serves GET /v1/sla?window=, covering the capture tasks that finished
+// within window, sla.retention by default.
+func (app *Config) GetSLA(w http.ResponseWriter, r *http.Request) {
+	window := app.cfg.SLA.Retention
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 || d > app.cfg.SLA.Retention {
+			writeError(w, r, http.StatusBadRequest, codeValidation, "request failed validation", service.FieldError{
+				Field:   "window",
+				Message: "must be a positive duration no longer than " + app.cfg.SLA.Retention.String(),
+			})
+			return
+		}
+		window = d
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(SLAPayload{Window: window.String(), SLAReport: app.sla.Report(window)})
+	w.Write(out)
+}
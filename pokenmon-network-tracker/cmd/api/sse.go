@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StreamEventSSE streams the hub events as text/event-stream for clients that cannot use WebSocket.
+// It accepts the same filter and backpressure parameters as /state/events and resumes from Last-Event-ID.
+func (app *Config) StreamEventSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "streaming unsupported")
+		return
+	}
+
+	client, err := newClient(r, "sse")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	app.hub.register <- client
+	defer func() {
+		app.hub.unregister <- client
+	}()
+
+	heartbeat := time.NewTicker(app.cfg.Hub.SSEHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case e, ok := <-client.send:
+			if !ok {
+				if client.closeReason != "" {
+					fmt.Fprintf(w, "event: close\ndata: %s\n\n", client.closeReason)
+					flusher.Flush()
+				}
+				return
+			}
+			if e.id > 0 {
+				fmt.Fprintf(w, "id: %d\n", e.id)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", e.payload)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"pokemonSightingApp/cmd/internal/webhook"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type WebhookPayload struct {
+	webhook.Subscription
+	Message string `json:"message,omitempty"`
+}
+
+func (app *Config) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var p WebhookPayload
+	err := app.readJSON(w, r, &p)
+	if err != nil {
+		log.Println(err)
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+
+	sub, err := app.webhooks.Subscribe(p.Subscription)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeInvalidRequest, err.Error())
+		return
+	}
+
+	p.Subscription = sub
+	p.Secret = ""
+	p.Message = "Successfully registered webhook"
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	out, _ := json.Marshal(p)
+	w.Write(out)
+}
+
+func (app *Config) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(app.webhooks.List())
+	w.Write(out)
+}
+
+func (app *Config) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := app.webhooks.Unsubscribe(chi.URLParam(r, "id"))
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Config) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveries, err := app.webhooks.Deliveries(chi.URLParam(r, "id"))
+	if errors.Is(err, webhook.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, codeNotFound, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	out, _ := json.Marshal(deliveries)
+	w.Write(out)
+}
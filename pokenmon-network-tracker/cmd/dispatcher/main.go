@@ -0,0 +1,61 @@
+// Command dispatcher turns reported sightings into capture tasks. It talks to
+// the rest of the tracker only through the broker.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/config"
+	"syscall"
+)
+
+func main() {
+	cfg, err := config.Load("dispatcher", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	log.Printf("Configuration:\n%s", cfg.Redacted())
+
+	conn, err := event.RabbitMQConnect(cfg.Broker.URL)
+	if err != nil {
+		log.Panic(err)
+	}
+	topo := event.TopologyOf(cfg.Broker)
+
+	bus, err := event.NewBusBroadcaster(conn, topo)
+	if err != nil {
+		log.Panic(err)
+	}
+	dispatcher, err := event.DispatchSetup(conn, topo, event.DispatchOptions{
+		Name:        cfg.Dispatch.Name,
+		Topics:      []string{"pokemon.sighting.#"},
+		Delay:       cfg.Dispatch.Delay,
+		DedupWindow: cfg.Dispatch.DedupWindow,
+	}, bus)
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("Dispatching %s to %s", cfg.Broker.SightingQueue, cfg.Broker.TaskQueue)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go bus.Beat(ctx, event.DispatcherComponent, cfg.Agent.HeartbeatInterval, dispatcher.Running)
+	<-ctx.Done()
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := dispatcher.Stop(ctx); err != nil {
+		log.Println("dispatcher:", err)
+	}
+	bus.Close()
+	conn.Close()
+	log.Println("Shutdown complete")
+}
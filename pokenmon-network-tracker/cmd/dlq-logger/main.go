@@ -0,0 +1,57 @@
+// Command dlq-logger announces capture tasks that expired into the dead
+// letter queue. It talks to the rest of the tracker only through the broker.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/config"
+	"syscall"
+)
+
+func main() {
+	cfg, err := config.Load("dlq-logger", os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	log.Printf("Configuration:\n%s", cfg.Redacted())
+
+	conn, err := event.RabbitMQConnect(cfg.Broker.URL)
+	if err != nil {
+		log.Panic(err)
+	}
+	topo := event.TopologyOf(cfg.Broker)
+
+	bus, err := event.NewBusBroadcaster(conn, topo)
+	if err != nil {
+		log.Panic(err)
+	}
+	// the API keeps the escape count that is served; this one only feeds the log line
+	dlq, err := event.DLQSetup(conn, topo, bus, &event.EscapeCounter{})
+	if err != nil {
+		log.Panic(err)
+	}
+	log.Printf("Watching %s", cfg.Broker.DeadLetterQueue)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go bus.Beat(ctx, event.DLQLoggerComponent, cfg.Agent.HeartbeatInterval, dlq.Running)
+	<-ctx.Done()
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.HTTP.ShutdownTimeout)
+	defer cancel()
+	if err := dlq.Stop(ctx); err != nil {
+		log.Println("dead letter consumer:", err)
+	}
+	bus.Close()
+	conn.Close()
+	log.Println("Shutdown complete")
+}
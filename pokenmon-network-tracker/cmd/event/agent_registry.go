@@ -0,0 +1,73 @@
+package event
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// AgentRegistry owns the running rocket agents and hands out their ids.
+// It is safe for concurrent use by HTTP handlers and consumer goroutines.
+type AgentRegistry struct {
+	mu     sync.RWMutex
+	agents []*RocketAgent
+	nextId int
+}
+
+func NewAgentRegistry() *AgentRegistry {
+	return &AgentRegistry{nextId: 1}
+}
+
+// NextId reserves a new agent id.
+func (a *AgentRegistry) NextId() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	id := a.nextId
+	a.nextId++
+	return id
+}
+
+func (a *AgentRegistry) Add(agent *RocketAgent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.agents = append(a.agents, agent)
+}
+
+// Remove drops the agent from the registry without stopping it.
+func (a *AgentRegistry) Remove(id int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.agents = slices.DeleteFunc(a.agents, func(agent *RocketAgent) bool { return agent.Id == id })
+}
+
+// List returns a snapshot of the registered agents.
+func (a *AgentRegistry) List() []*RocketAgent {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return append([]*RocketAgent{}, a.agents...)
+}
+
+func (a *AgentRegistry) Count() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.agents)
+}
+
+// StopAll empties the registry and stops every agent that was in it.
+// Agents still busy when ctx is done hand their task back to the queue.
+func (a *AgentRegistry) StopAll(ctx context.Context) {
+	a.mu.Lock()
+	agents := a.agents
+	a.agents = nil
+	a.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent.StopContext(ctx)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,191 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/leaderboard"
+	"strings"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// BusBroadcaster publishes broadcast events onto the event exchange, where the
+// API picks them up and fans them out to its own sinks. The worker binaries
+// use it in place of the hub.
+type BusBroadcaster struct {
+	ch       *amqp.Channel
+	exchange string
+}
+
+func NewBusBroadcaster(conn *amqp.Connection, topo Topology) (*BusBroadcaster, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := declareFleet(ch, topo); err != nil {
+		ch.Close()
+		return nil, err
+	}
+	return &BusBroadcaster{ch: ch, exchange: topo.EventExchange}, nil
+}
+
+func (b *BusBroadcaster) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	message, err := broadcast.NewMessage(msg, messageType, includeTime, options)
+	if err != nil {
+		log.Printf("error - %v", err)
+		return
+	}
+	key := eventKeyPrefix + strings.ReplaceAll(messageType, " ", "_")
+	if err := b.publish(key, message); err != nil {
+		log.Printf("failed to publish %s event: %v", messageType, err)
+	}
+}
+
+// Heartbeat reports an agent's heartbeat to the API.
+func (b *BusBroadcaster) Heartbeat(h Heartbeat) {
+	if err := b.publish(agentHeartbeatKey, h); err != nil {
+		log.Printf("failed to publish heartbeat of agent %d: %v", h.Agent.Id, err)
+	}
+}
+
+func (b *BusBroadcaster) publish(key string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.ch.Publish(b.exchange, key, false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Body:        body,
+	})
+}
+
+func (b *BusBroadcaster) Close() error {
+	return b.ch.Close()
+}
+
+// BusState is what the API learns from the event exchange.
+type BusState struct {
+	Fleet       *Fleet
+	Components  *Components
+	Captures    *CaptureCounter
+	Escapes     *EscapeCounter
+	Ages        *TaskAges
+	Merges      *MergedReporters
+	SLA         *SLATracker
+	Leaderboard *leaderboard.Board
+}
+
+// BusSetup consumes what the worker binaries report on the event exchange:
+// worker snapshots and agent heartbeats update the fleet, component heartbeats
+// the components, captures and escapes are counted, task dispatches and pickups
+// feed the ages, merged sightings add their reporters to the task's capture or
+// escape, task events feed the SLA tracker and the leaderboard, and every event
+// is passed on to b. It asks the running workers to announce themselves so an API that
+// restarts rebuilds its fleet straight away.
+func BusSetup(conn *amqp.Connection, topo Topology, state BusState, b broadcast.Broadcaster) (*Consumer, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	if err := declareFleet(ch, topo); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	// every API replica gets its own copy of the events
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	for _, key := range []string{"status.#", eventKeyPrefix + "#"} {
+		if err := ch.QueueBind(q.Name, key, topo.EventExchange, false, nil); err != nil {
+			ch.Close()
+			return nil, err
+		}
+	}
+
+	tag := "api-bus"
+	msgs, err := ch.Consume(q.Name, tag, true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	err = ch.Publish(topo.ControlExchange, announceKey, false, false, amqp.Publishing{ContentType: "application/json", Body: []byte("{}")})
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to request worker announcements: %w", err)
+	}
+
+	consumer := newConsumer(ch, tag)
+	go func() {
+		defer consumer.finish()
+		defer ch.Close()
+
+		for d := range msgs {
+			switch {
+			case d.RoutingKey == workerKey:
+				var w WorkerInfo
+				if err := json.Unmarshal(d.Body, &w); err != nil {
+					log.Printf("Failed to unmarshal worker status: %v", err)
+					continue
+				}
+				state.Fleet.Update(w)
+			case d.RoutingKey == agentHeartbeatKey:
+				var h Heartbeat
+				if err := json.Unmarshal(d.Body, &h); err != nil {
+					log.Printf("Failed to unmarshal heartbeat: %v", err)
+					continue
+				}
+				announce(b, state.Fleet.Heartbeat(h))
+			case d.RoutingKey == componentKey:
+				var c ComponentBeat
+				if err := json.Unmarshal(d.Body, &c); err != nil {
+					log.Printf("Failed to unmarshal component heartbeat: %v", err)
+					continue
+				}
+				state.Components.Beat(c.Name)
+			case d.RoutingKey == workerDownKey:
+				var w WorkerInfo
+				if err := json.Unmarshal(d.Body, &w); err != nil {
+					log.Printf("Failed to unmarshal worker status: %v", err)
+					continue
+				}
+				state.Fleet.Remove(w.Id)
+				b.Broadcast(fmt.Sprintf("Agent worker %s went offline", w.Id), "agent log", true, map[string]any{"worker": w.Id})
+			case strings.HasPrefix(d.RoutingKey, eventKeyPrefix):
+				forwardEvent(d.Body, state, b)
+			}
+		}
+	}()
+
+	return consumer, nil
+}
+
+// forwardEvent replays an event published by a BusBroadcaster, keeping its original time.
+func forwardEvent(body []byte, state BusState, b broadcast.Broadcaster) {
+	var message map[string]any
+	if err := json.Unmarshal(body, &message); err != nil {
+		log.Printf("Failed to unmarshal event: %v", err)
+		return
+	}
+	messageType, _ := message["type"].(string)
+	msg, _ := message["message"].(string)
+	delete(message, "type")
+	delete(message, "message")
+
+	switch messageType {
+	case "pokemon capture":
+		state.Captures.count.Add(1)
+	case "pokemon escape":
+		state.Escapes.count.Add(1)
+	}
+	state.Ages.Observe(messageType, message)
+	state.Merges.Observe(messageType, message)
+	state.SLA.Observe(messageType, message)
+	score(state.Leaderboard, messageType, message)
+	b.Broadcast(msg, messageType, false, message)
+}
@@ -1,51 +1,80 @@
 package event
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"math/rand"
 	"pokemonSightingApp/cmd/internal/broadcast"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-const taskQueue = "pokemon_tasks"
-
-var AgentList []*RocketAgent
-
 type RocketAgent struct {
-	Id          int    `json:"id"`
-	Name        string `json:"name"`
-	ImageNum    int    `json:"imageNum"`
-	conn        *amqp.Connection
-	queueName   string
-	queueArgs   amqp.Table
-	b           broadcast.Broadcaster
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	ImageNum int    `json:"imageNum"`
+	conn     *amqp.Connection
+	topo     Topology
+	work     AgentOptions
+	b        broadcast.Broadcaster
+	stopCh   chan struct{}
+	doneCh   chan struct{}
+	abortCh  chan struct{}
+	stopOnce sync.Once
+	// busy is set while a task is being worked on
+	busy atomic.Bool
+	// crashed is set when the task consumer ended without Stop being called
+	crashed atomic.Bool
+
+	// mu guards the consumer state shared by Listen and Stop
+	mu          sync.Mutex
 	consumerTag string
 	channel     *amqp.Channel
-	stopCh      chan struct{}
-	doneCh      chan struct{}
+	listening   bool
+	stopped     bool
 }
 
-func NewRocketAgent(conn *amqp.Connection, id int, name string, imageNum int, b broadcast.Broadcaster) (*RocketAgent, error) {
+// AgentOptions shapes how an agent works through capture tasks: each attempt
+// takes a random time between MinTaskTime and MaxTaskTime and fails with FailureRate.
+// While consuming, the agent sends a heartbeat to Heartbeats every HeartbeatInterval.
+type AgentOptions struct {
+	MinTaskTime time.Duration
+	MaxTaskTime time.Duration
+	FailureRate float64
+
+	Worker            string
+	HeartbeatInterval time.Duration
+	Heartbeats        HeartbeatSink
+}
+
+func (o AgentOptions) taskTime() time.Duration {
+	return o.MinTaskTime + time.Duration(rand.Int63n(int64(o.MaxTaskTime-o.MinTaskTime)+1))
+}
+
+func NewRocketAgent(conn *amqp.Connection, topo Topology, work AgentOptions, id int, name string, imageNum int, b broadcast.Broadcaster) (*RocketAgent, error) {
 	agent := &RocketAgent{
-		Id:        id,
-		Name:      name,
-		ImageNum:  imageNum,
-		conn:      conn,
-		queueName: taskQueue,
-		b:         b,
-		stopCh:    make(chan struct{}),
-		doneCh:    make(chan struct{}),
+		Id:       id,
+		Name:     name,
+		ImageNum: imageNum,
+		conn:     conn,
+		topo:     topo,
+		work:     work,
+		b:        b,
+		stopCh:   make(chan struct{}),
+		doneCh:   make(chan struct{}),
+		abortCh:  make(chan struct{}),
 	}
 	err := agent.setup()
 	if err != nil {
 		log.Println(err)
 		return agent, err
 	}
-	AgentList = append(AgentList, agent)
 	return agent, nil
 }
 
@@ -54,11 +83,7 @@ func (r *RocketAgent) setup() error {
 	if err != nil {
 		return err
 	}
-	r.queueArgs = amqp.Table{
-		"x-dead-letter-exchange":    "",
-		"x-dead-letter-routing-key": "dead_letter_tasks",
-	}
-	_, err = ch.QueueDeclare(r.queueName, true, false, false, false, r.queueArgs)
+	_, err = ch.QueueDeclare(r.topo.TaskQueue, true, false, false, false, r.topo.taskQueueArgs())
 	if err != nil {
 		return err
 	}
@@ -72,34 +97,21 @@ func (r *RocketAgent) setup() error {
 	return nil
 }
 
-func DeleteAllAgents() {
-	for _, agent := range AgentList {
-		agent.Stop()
-	}
-	AgentList = nil
-}
-
-func ResetAllQueues() error {
-	conn, err := RabbitMQConnect()
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-
+func ResetAllQueues(conn *amqp.Connection, topo Topology) error {
 	ch, err := conn.Channel()
 	if err != nil {
 		return err
 	}
 	defer ch.Close()
 
-	// Purge the pokemon_tasks queue to remove all messages and reset consumer count
-	_, err = ch.QueuePurge("pokemon_tasks", false)
+	// Purge the task queue to remove all messages and reset consumer count
+	_, err = ch.QueuePurge(topo.TaskQueue, false)
 	if err != nil {
 		return err
 	}
 
 	// Purge the dead letter queue as well
-	_, err = ch.QueuePurge("dead_letter_tasks", false)
+	_, err = ch.QueuePurge(topo.DeadLetterQueue, false)
 	if err != nil {
 		// Don't fail if dead letter queue doesn't exist
 		return nil
@@ -108,21 +120,43 @@ func ResetAllQueues() error {
 	return nil
 }
 
+// Stop cancels the agent's consumer and waits for the current task to finish.
+// It is safe to call more than once and before Listen.
 func (r *RocketAgent) Stop() {
-	if r.channel != nil && r.consumerTag != "" {
-		_ = r.channel.Cancel(r.consumerTag, false)
-	}
-	close(r.stopCh)
-	<-r.doneCh
-	if r.channel != nil {
-		_ = r.channel.Close()
-	}
-	r.b.Broadcast(
-		fmt.Sprintf("Stopped rocket agent %d, %s", r.Id, r.Name),
-		"agent log",
-		true,
-		map[string]any{"id": r.Id, "name": r.Name},
-	)
+	r.StopContext(context.Background())
+}
+
+// StopContext is Stop with a deadline: once ctx is done the current task is
+// abandoned and nacked back onto the queue for another agent.
+func (r *RocketAgent) StopContext(ctx context.Context) {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		r.stopped = true
+		ch, tag, listening := r.channel, r.consumerTag, r.listening
+		r.mu.Unlock()
+
+		if ch != nil && tag != "" {
+			_ = ch.Cancel(tag, false)
+		}
+		close(r.stopCh)
+		if listening {
+			select {
+			case <-r.doneCh:
+			case <-ctx.Done():
+				close(r.abortCh)
+				<-r.doneCh
+			}
+		}
+		if ch != nil {
+			_ = ch.Close()
+		}
+		r.b.Broadcast(
+			fmt.Sprintf("Stopped rocket agent %d, %s", r.Id, r.Name),
+			"agent log",
+			true,
+			map[string]any{"id": r.Id, "name": r.Name},
+		)
+	})
 }
 
 func (r *RocketAgent) Listen() error {
@@ -131,33 +165,63 @@ func (r *RocketAgent) Listen() error {
 		log.Println(err)
 		return err
 	}
-	r.channel = ch
-	r.consumerTag = fmt.Sprintf("agent-%d-%s", r.Id, r.Name)
+	consumerTag := fmt.Sprintf("agent-%d-%s", r.Id, r.Name)
 
 	ch.Qos(1, 0, false) // prefetch=1
 
 	tasks, err := ch.Consume(
-		"pokemon_tasks", // queue
-		r.consumerTag,   // explicit consumer tag
-		false,           // auto-ack: true = no need to call d.Ack()
-		false,           // exclusive: ❌ don't use true here
-		true,            // no-local: ignored by RabbitMQ
-		false,           // no-wait
-		nil,             // args
+		r.topo.TaskQueue, // queue
+		consumerTag,      // explicit consumer tag
+		false,            // auto-ack: true = no need to call d.Ack()
+		false,            // exclusive: ❌ don't use true here
+		true,             // no-local: ignored by RabbitMQ
+		false,            // no-wait
+		nil,              // args
 	)
 	if err != nil {
 		return err
 	}
 
+	r.mu.Lock()
+	if r.stopped {
+		r.mu.Unlock()
+		_ = ch.Close()
+		return nil
+	}
+	r.channel = ch
+	r.consumerTag = consumerTag
+	r.listening = true
+	r.mu.Unlock()
+
 	go func() {
 		defer close(r.doneCh)
+		// heartbeats come from this loop, so they stop whenever it stalls
+		var beats <-chan time.Time
+		if r.work.Heartbeats != nil && r.work.HeartbeatInterval > 0 {
+			ticker := time.NewTicker(r.work.HeartbeatInterval)
+			defer ticker.Stop()
+			beats = ticker.C
+			r.heartbeat()
+		}
 		for {
 			select {
+			case <-beats:
+				r.heartbeat()
 			case task, ok := <-tasks:
 				if !ok {
+					r.mu.Lock()
+					r.crashed.Store(!r.stopped)
+					r.mu.Unlock()
+					return
+				}
+				select {
+				case <-r.stopCh:
+					// stopping: leave the prefetched task for the broker to requeue
+					task.Nack(false, true)
 					return
+				default:
 				}
-				r.handleTask(&task)
+				r.handleTask(&task, beats)
 			case <-r.stopCh:
 				return
 			}
@@ -167,7 +231,31 @@ func (r *RocketAgent) Listen() error {
 	return nil
 }
 
-func (r *RocketAgent) handleTask(task *amqp.Delivery) {
+// Done is closed once the agent stopped consuming, whether it was stopped or crashed.
+func (r *RocketAgent) Done() <-chan struct{} {
+	return r.doneCh
+}
+
+// Crashed reports whether the agent lost its task consumer without being stopped.
+func (r *RocketAgent) Crashed() bool {
+	return r.crashed.Load()
+}
+
+// heartbeat reports the agent alive. The task loop calls it every HeartbeatInterval.
+func (r *RocketAgent) heartbeat() {
+	r.work.Heartbeats.Heartbeat(Heartbeat{
+		Agent: AgentInfo{Id: r.Id, Name: r.Name, ImageNum: r.ImageNum, Worker: r.work.Worker},
+		Busy:  r.busy.Load(),
+		Time:  time.Now(),
+	})
+}
+
+// handleTask works on one capture task, sending a heartbeat on every tick of
+// beats while it waits.
+func (r *RocketAgent) handleTask(task *amqp.Delivery, beats <-chan time.Time) {
+	r.busy.Store(true)
+	defer r.busy.Store(false)
+
 	var c captureTask
 	if err := json.Unmarshal(task.Body, &c); err != nil {
 		fmt.Printf("Failed to unmarshal task: %v\n", err)
@@ -177,21 +265,37 @@ func (r *RocketAgent) handleTask(task *amqp.Delivery) {
 	options := map[string]any{
 		"name":   r.Name,
 		"id":     r.Id,
+		"epoch":  c.Epoch,
 		"taskId": c.TaskId,
 	}
 
 	msg := fmt.Sprintf("[%d ID | %s] Agent processing task: %s at %s", r.Id, r.Name, c.Pokemon, c.Location)
-	r.b.Broadcast(msg, "agent log", true, options)
+	pickup := map[string]any{"name": r.Name, "id": r.Id, "epoch": c.Epoch, "taskId": c.TaskId, "element": c.Element, "stage": StagePickup, "at": time.Now()}
+	r.b.Broadcast(msg, "agent log", true, pickup)
 
-	timeDuration := rand.Intn(3) + 2
+	timeDuration := r.work.taskTime()
 
-	msg = fmt.Sprintf("[%d ID | %s] Agent started task (estimated duration: %d): %s at %s", r.Id, r.Name, timeDuration, c.Pokemon, c.Location)
-	time.Sleep(time.Duration(timeDuration) * time.Second)
+	msg = fmt.Sprintf("[%d ID | %s] Agent started task (estimated duration: %d): %s at %s", r.Id, r.Name, int(timeDuration.Seconds()), c.Pokemon, c.Location)
+	done := time.After(timeDuration)
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-beats:
+			r.heartbeat()
+		case <-r.abortCh:
+			task.Nack(false, true)
+			msg = fmt.Sprintf("[%d ID | %s] Agent stood down mid-task and handed it back to HQ: %s at %s", r.Id, r.Name, c.Pokemon, c.Location)
+			r.b.Broadcast(msg, "agent log", true, stage(options, StageAborted))
+			return
+		}
+	}
 	r.b.Broadcast(msg, "agent log", true, options)
 
-	if rand.Intn(5) == 1 {
+	if rand.Float64() < r.work.FailureRate {
 		msg := fmt.Sprintf("[%d ID | %s] Agent failed task: %s at %s", r.Id, r.Name, c.Pokemon, c.Location)
-		r.b.Broadcast(msg, "agent log", true, options)
+		r.b.Broadcast(msg, "agent log", true, stage(options, StageFailed))
 		task.Nack(false, true)
 		msg = fmt.Sprintf("[%d ID | %s] Agent reported failed task and request HQ to re-dispatch: %s at %s", r.Id, r.Name, c.Pokemon, c.Location)
 		r.b.Broadcast(msg, "agent log", true, options)
@@ -201,4 +305,25 @@ func (r *RocketAgent) handleTask(task *amqp.Delivery) {
 	msg = fmt.Sprintf(" [%d ID | %s] Agent captured %s at %s [%s]!", r.Id, r.Name, c.Pokemon, c.Location, c.Element)
 	task.Ack(false)
 	r.b.Broadcast(msg, "agent log", true, options)
+
+	r.b.Broadcast(fmt.Sprintf("%s captured at %s", c.Pokemon, c.Location), "pokemon capture", true, map[string]any{
+		"epoch":     c.Epoch,
+		"taskId":    c.TaskId,
+		"agentId":   r.Id,
+		"agent":     r.Name,
+		"pokemon":   c.Pokemon,
+		"location":  c.Location,
+		"element":   c.Element,
+		"reporters": c.Reporters,
+		"duration":  timeDuration.Seconds(),
+		"at":        time.Now(),
+	})
+}
+
+// stage marks a copy of options as the end of an attempt, for the SLA tracker.
+func stage(options map[string]any, name string) map[string]any {
+	out := maps.Clone(options)
+	out["stage"] = name
+	out["at"] = time.Now()
+	return out
 }
@@ -0,0 +1,69 @@
+package event
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+const componentKey = "status.component"
+
+// Names the pipeline processes send heartbeats under.
+const (
+	DispatcherComponent = "dispatcher"
+	DLQLoggerComponent  = "dlq-logger"
+)
+
+// ComponentBeat is the heartbeat of a pipeline process such as the dispatcher.
+type ComponentBeat struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// Beat reports name alive every interval while running says so, until ctx is done.
+func (b *BusBroadcaster) Beat(ctx context.Context, name string, interval time.Duration, running func() bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if running() {
+			if err := b.publish(componentKey, ComponentBeat{Name: name, Time: time.Now()}); err != nil {
+				log.Printf("failed to publish %s heartbeat: %v", name, err)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Components tracks when each pipeline process last sent a heartbeat.
+// It is safe for concurrent use.
+type Components struct {
+	mu      sync.RWMutex
+	seen    map[string]time.Time
+	started time.Time
+}
+
+func NewComponents() *Components {
+	return &Components{seen: make(map[string]time.Time), started: time.Now()}
+}
+
+func (c *Components) Beat(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[name] = time.Now()
+}
+
+// Silence is how long name has been quiet, counted from startup when it never reported.
+func (c *Components) Silence(name string) time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	last, ok := c.seen[name]
+	if !ok {
+		last = c.started
+	}
+	return time.Since(last)
+}
@@ -0,0 +1,80 @@
+package event
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CaptureCounter counts the pokemon the agents captured.
+type CaptureCounter struct {
+	count atomic.Int64
+}
+
+func (c *CaptureCounter) Get() int {
+	return int(c.count.Load())
+}
+
+// maxTaskWait bounds how long TaskAges waits for the pickup of a dispatched
+// task; tasks expire long before.
+const maxTaskWait = 10 * time.Minute
+
+// TaskAges averages how long capture tasks waited in the task queue before an
+// agent picked them up. Both ends are timed when the API hears of them, so the
+// dispatcher's and the workers' clocks never meet. It is safe for concurrent use.
+type TaskAges struct {
+	mu    sync.Mutex
+	total time.Duration
+	count int
+	// waiting maps dispatched tasks to when the API heard of the dispatch
+	waiting map[taskKey]time.Time
+	now     func() time.Time
+}
+
+// Observe times the dispatch and pickup events of a task. Other events, and
+// pickups of tasks dispatched before the API listened, are ignored.
+func (t *TaskAges) Observe(messageType string, message map[string]any) {
+	key, ok := taskKeyOf(message)
+	if !ok {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.now == nil {
+		t.now = time.Now
+	}
+	now := t.now()
+	switch {
+	case messageType == "headquarter dispatch":
+		if t.waiting == nil {
+			t.waiting = make(map[taskKey]time.Time)
+		}
+		for k, at := range t.waiting {
+			if now.Sub(at) > maxTaskWait {
+				delete(t.waiting, k)
+			}
+		}
+		t.waiting[key] = now
+	case messageType == "agent log" && message["stage"] == StagePickup:
+		at, ok := t.waiting[key]
+		if !ok {
+			return
+		}
+		delete(t.waiting, key)
+		t.total += now.Sub(at)
+		t.count++
+	}
+}
+
+// Take returns the average age and the number of pickups seen since the
+// previous call, and starts over.
+func (t *TaskAges) Take() (time.Duration, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total, count := t.total, t.count
+	t.total, t.count = 0, 0
+	if count == 0 {
+		return 0, 0
+	}
+	return total / time.Duration(count), count
+}
@@ -0,0 +1,61 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTaskAgesUseTheAPIClock(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ages := &TaskAges{now: func() time.Time { return now }}
+	pickup := func(taskId int) map[string]any {
+		// the worker's clock is an hour off; its timestamps are not used
+		return map[string]any{"taskId": float64(taskId), "stage": StagePickup, "at": now.Add(time.Hour)}
+	}
+
+	ages.Observe("headquarter dispatch", map[string]any{"taskId": float64(1), "dispatchedAt": now.Add(-time.Hour)})
+	now = now.Add(2 * time.Second)
+	ages.Observe("headquarter dispatch", map[string]any{"taskId": float64(2)})
+	now = now.Add(2 * time.Second)
+	ages.Observe("agent log", pickup(1))
+	ages.Observe("agent log", pickup(2))
+	// dispatched before the API listened
+	ages.Observe("agent log", pickup(3))
+	// picked up twice: only the first counts
+	now = now.Add(time.Minute)
+	ages.Observe("agent log", pickup(1))
+
+	if age, count := ages.Take(); age != 3*time.Second || count != 2 {
+		t.Errorf("Take() = %s, %d, want 3s, 2", age, count)
+	}
+	if age, count := ages.Take(); age != 0 || count != 0 {
+		t.Errorf("second Take() = %s, %d, want 0, 0", age, count)
+	}
+}
+
+func TestTaskAgesForgetTasksNeverPickedUp(t *testing.T) {
+	now := time.Now()
+	ages := &TaskAges{now: func() time.Time { return now }}
+	ages.Observe("headquarter dispatch", map[string]any{"taskId": float64(1)})
+	now = now.Add(maxTaskWait + time.Second)
+	ages.Observe("headquarter dispatch", map[string]any{"taskId": float64(2)})
+	if len(ages.waiting) != 1 {
+		t.Errorf("waiting = %v", ages.waiting)
+	}
+}
+
+func TestTaskAgesKeepEpochsApart(t *testing.T) {
+	now := time.Now()
+	ages := &TaskAges{now: func() time.Time { return now }}
+	ages.Observe("headquarter dispatch", map[string]any{"epoch": "e1", "taskId": float64(0)})
+	now = now.Add(4 * time.Second)
+	// the restarted dispatcher numbers its first task 0 again
+	ages.Observe("headquarter dispatch", map[string]any{"epoch": "e2", "taskId": float64(0)})
+	now = now.Add(2 * time.Second)
+	ages.Observe("agent log", map[string]any{"epoch": "e1", "taskId": float64(0), "stage": StagePickup})
+	ages.Observe("agent log", map[string]any{"epoch": "e2", "taskId": float64(0), "stage": StagePickup})
+
+	if age, count := ages.Take(); age != 4*time.Second || count != 2 {
+		t.Errorf("Take() = %s, %d, want 4s, 2", age, count)
+	}
+}
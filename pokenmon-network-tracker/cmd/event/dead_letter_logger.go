@@ -5,45 +5,52 @@ import (
 	"fmt"
 	"log"
 	"pokemonSightingApp/cmd/internal/broadcast"
+	"sync/atomic"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-var TotalCount int = 0
+// EscapeCounter counts the capture tasks that ended up in the dead letter queue.
+type EscapeCounter struct {
+	count atomic.Int64
+}
 
-func GetDLQTotalCount() int {
-	return TotalCount
+func (e *EscapeCounter) Get() int {
+	return int(e.count.Load())
 }
 
-func ReSetTotalCount() {
-	TotalCount = 0
+func (e *EscapeCounter) Reset() {
+	e.count.Store(0)
 }
 
-func DLQSetup(conn *amqp.Connection, b broadcast.Broadcaster) error {
+// DLQSetup starts counting and announcing escaped pokemon.
+// The returned Consumer reports whether it is still running and stops it.
+// The connection belongs to the caller and is left open.
+func DLQSetup(conn *amqp.Connection, topo Topology, b broadcast.Broadcaster, escapes *EscapeCounter) (*Consumer, error) {
 
 	ch, err := conn.Channel()
 	if err != nil {
-		conn.Close()
-		return fmt.Errorf("failed to open channel: %w", err)
+		return nil, fmt.Errorf("failed to open channel: %w", err)
 	}
 
-	_, err = ch.QueueDeclare("dead_letter_tasks", true, false, false, false, nil)
+	_, err = ch.QueueDeclare(topo.DeadLetterQueue, true, false, false, false, nil)
 	if err != nil {
 		ch.Close()
-		conn.Close()
-		return fmt.Errorf("failed to declare queue: %w", err)
+		return nil, fmt.Errorf("failed to declare queue: %w", err)
 	}
 
-	msgs, err := ch.Consume("dead_letter_tasks", "", true, false, false, false, nil)
+	tag := "dlq-logger"
+	msgs, err := ch.Consume(topo.DeadLetterQueue, tag, true, false, false, false, nil)
 	if err != nil {
 		ch.Close()
-		conn.Close()
-		return fmt.Errorf("failed to start consuming: %w", err)
+		return nil, fmt.Errorf("failed to start consuming: %w", err)
 	}
 
+	consumer := newConsumer(ch, tag)
 	go func() {
+		defer consumer.finish()
 		defer ch.Close()
-		defer conn.Close()
 
 		for d := range msgs {
 			var task captureTask
@@ -52,12 +59,19 @@ func DLQSetup(conn *amqp.Connection, b broadcast.Broadcaster) error {
 				continue
 			}
 
-			fmt.Println(TotalCount)
+			escapes.count.Add(1)
 			msg := fmt.Sprintf("[DLQ] Missed opportunity! %s escaped from %s (%s)", task.Pokemon, task.Location, task.Element)
-			TotalCount++
-			b.Broadcast(msg, "pokemon escape", true, nil)
+			b.Broadcast(msg, "pokemon escape", true, map[string]any{
+				"epoch":     task.Epoch,
+				"taskId":    task.TaskId,
+				"pokemon":   task.Pokemon,
+				"location":  task.Location,
+				"element":   task.Element,
+				"reporters": task.Reporters,
+				"at":        time.Now(),
+			})
 		}
 	}()
 
-	return nil
+	return consumer, nil
 }
@@ -0,0 +1,338 @@
+package event
+
+import (
+	"cmp"
+	"fmt"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Routing keys on the control and event exchanges.
+const (
+	// SpawnKey commands are shared: exactly one worker picks each one up
+	SpawnKey = "agent.spawn"
+	// StopKey, DrainKey, ReapKey and announceKey commands reach every worker
+	StopKey     = "agent.stop"
+	DrainKey    = "agent.drain"
+	ReapKey     = "agent.reap"
+	announceKey = "worker.announce"
+
+	workerKey         = "status.worker"
+	workerDownKey     = "status.worker.down"
+	agentHeartbeatKey = "status.agent.heartbeat"
+	eventKeyPrefix    = "event."
+)
+
+// Agent liveness states. Dead agents are dropped from the fleet.
+const (
+	AgentAlive = "alive"
+	AgentStale = "stale"
+	AgentDead  = "dead"
+)
+
+// AgentInfo describes a rocket agent and the worker running it.
+type AgentInfo struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	ImageNum int    `json:"imageNum"`
+	// Worker is empty until a worker has picked up the spawn command.
+	Worker string `json:"worker,omitempty"`
+	// State and LastSeen are filled in by the Fleet from the heartbeats.
+	State    string    `json:"state,omitempty"`
+	LastSeen time.Time `json:"lastSeen,omitzero"`
+	// Busy is set while the agent's last heartbeat reported it working on a task.
+	Busy bool `json:"busy"`
+}
+
+// WorkerInfo is the snapshot an agent worker reports whenever its agents
+// change and on every heartbeat interval.
+type WorkerInfo struct {
+	Id       string      `json:"id"`
+	Capacity int         `json:"capacity"`
+	Agents   []AgentInfo `json:"agents"`
+	LastSeen time.Time   `json:"lastSeen,omitzero"`
+}
+
+// Heartbeat is what an agent reports while it is consuming tasks.
+type Heartbeat struct {
+	Agent AgentInfo `json:"agent"`
+	// Busy is set while the agent works on a task.
+	Busy bool      `json:"busy"`
+	Time time.Time `json:"time"`
+}
+
+type HeartbeatSink interface {
+	Heartbeat(h Heartbeat)
+}
+
+// Transition is a change in an agent's liveness.
+type Transition struct {
+	Agent AgentInfo
+	From  string
+	To    string
+}
+
+type trackedWorker struct {
+	id       string
+	capacity int
+	lastSeen time.Time
+}
+
+// Fleet is the API's view of the agent workers and their agents, built from
+// their snapshots and heartbeats. An agent that misses heartbeats for
+// staleAfter is marked stale, and after deadAfter it is declared dead and
+// dropped; its slot is freed once its worker has reaped it. It is safe for
+// concurrent use.
+type Fleet struct {
+	mu      sync.RWMutex
+	workers map[string]*trackedWorker
+	agents  map[int]*AgentInfo
+	// dead maps agents declared dead to their worker until the worker's
+	// snapshot no longer lists them. They keep their slot until then, and a
+	// snapshot still listing them does not bring them back; a heartbeat does
+	dead   map[int]string
+	nextId int
+
+	staleAfter time.Duration
+	deadAfter  time.Duration
+}
+
+func NewFleet(staleAfter, deadAfter time.Duration) *Fleet {
+	return &Fleet{
+		workers:    make(map[string]*trackedWorker),
+		agents:     make(map[int]*AgentInfo),
+		dead:       make(map[int]string),
+		nextId:     1,
+		staleAfter: staleAfter,
+		deadAfter:  deadAfter,
+	}
+}
+
+// NextId reserves a new agent id.
+func (f *Fleet) NextId() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.nextId
+	f.nextId++
+	return id
+}
+
+// Reserve keeps NextId above id, so agents scored before a restart keep their own ids.
+func (f *Fleet) Reserve(id int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seen(id)
+}
+
+// seen keeps ids unique even when the workers outlived an API restart.
+func (f *Fleet) seen(id int) {
+	if id >= f.nextId {
+		f.nextId = id + 1
+	}
+}
+
+// Update records a worker's snapshot. Agents it no longer lists were stopped
+// and are dropped; agents new to the fleet start out alive.
+func (f *Fleet) Update(w WorkerInfo) {
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.workers[w.Id] = &trackedWorker{id: w.Id, capacity: w.Capacity, lastSeen: now}
+	listed := make(map[int]bool, len(w.Agents))
+	for _, a := range w.Agents {
+		f.seen(a.Id)
+		listed[a.Id] = true
+		if _, ok := f.dead[a.Id]; ok {
+			continue
+		}
+		if _, ok := f.agents[a.Id]; !ok {
+			a.Worker, a.State, a.LastSeen = w.Id, AgentAlive, now
+			f.agents[a.Id] = &a
+		}
+	}
+	for id, a := range f.agents {
+		if a.Worker == w.Id && !listed[id] {
+			delete(f.agents, id)
+		}
+	}
+	for id, worker := range f.dead {
+		if worker == w.Id && !listed[id] {
+			delete(f.dead, id)
+		}
+	}
+}
+
+// Remove forgets a worker that shut down, along with its agents.
+func (f *Fleet) Remove(workerId string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.workers, workerId)
+	for id, a := range f.agents {
+		if a.Worker == workerId {
+			delete(f.agents, id)
+		}
+	}
+	for id, worker := range f.dead {
+		if worker == workerId {
+			delete(f.dead, id)
+		}
+	}
+}
+
+// Heartbeat marks the agent alive, registering it if the fleet did not know it.
+// It returns the transition when a stale or dead agent came back. Heartbeats
+// from agents of a worker the fleet does not know are ignored: the worker went
+// down or was removed, and its next snapshot registers the agents again.
+func (f *Fleet) Heartbeat(h Heartbeat) []Transition {
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.workers[h.Agent.Worker]; !ok {
+		return nil
+	}
+	f.seen(h.Agent.Id)
+	a, ok := f.agents[h.Agent.Id]
+	if !ok {
+		info := h.Agent
+		info.State, info.LastSeen = AgentAlive, now
+		f.agents[info.Id] = &info
+		if _, wasDead := f.dead[info.Id]; wasDead {
+			delete(f.dead, info.Id)
+			return []Transition{{Agent: info, From: AgentDead, To: AgentAlive}}
+		}
+		return nil
+	}
+
+	a.LastSeen, a.Busy = now, h.Busy
+	if a.State == AgentStale {
+		a.State = AgentAlive
+		return []Transition{{Agent: *a, From: AgentStale, To: AgentAlive}}
+	}
+	return nil
+}
+
+// Sweep marks agents that went quiet stale, drops the ones that stayed quiet
+// as dead, forgets workers that stopped reporting, and announces every change on b.
+// It returns the agents declared dead, for their workers to be told to reap them.
+func (f *Fleet) Sweep(b broadcast.Broadcaster) []AgentInfo {
+	now := time.Now()
+	var transitions []Transition
+	var lost []string
+	var dead []AgentInfo
+
+	f.mu.Lock()
+	for id, a := range f.agents {
+		quiet := now.Sub(a.LastSeen)
+		switch {
+		case quiet > f.deadAfter:
+			transitions = append(transitions, Transition{Agent: *a, From: a.State, To: AgentDead})
+			dead = append(dead, *a)
+			delete(f.agents, id)
+			f.dead[id] = a.Worker
+		case quiet > f.staleAfter && a.State == AgentAlive:
+			a.State = AgentStale
+			transitions = append(transitions, Transition{Agent: *a, From: AgentAlive, To: AgentStale})
+		}
+	}
+	for id, w := range f.workers {
+		if now.Sub(w.lastSeen) > f.deadAfter {
+			delete(f.workers, id)
+			lost = append(lost, id)
+		}
+	}
+	for id, worker := range f.dead {
+		if _, ok := f.workers[worker]; !ok {
+			delete(f.dead, id)
+		}
+	}
+	f.mu.Unlock()
+
+	announce(b, transitions)
+	for _, id := range lost {
+		b.Broadcast(fmt.Sprintf("Agent worker %s stopped reporting and was removed", id), "agent log", true, map[string]any{"worker": id})
+	}
+	return dead
+}
+
+// announce broadcasts liveness transitions as "agent liveness" events.
+func announce(b broadcast.Broadcaster, transitions []Transition) {
+	slices.SortFunc(transitions, func(x, y Transition) int { return x.Agent.Id - y.Agent.Id })
+	for _, t := range transitions {
+		a := t.Agent
+		var msg string
+		switch t.To {
+		case AgentAlive:
+			msg = fmt.Sprintf("Rocket agent %d, %s is sending heartbeats again", a.Id, a.Name)
+		case AgentStale:
+			msg = fmt.Sprintf("Rocket agent %d, %s missed its heartbeats, last seen %s ago", a.Id, a.Name, time.Since(a.LastSeen).Round(time.Second))
+		case AgentDead:
+			msg = fmt.Sprintf("Rocket agent %d, %s is presumed dead and was removed", a.Id, a.Name)
+		}
+		b.Broadcast(msg, "agent liveness", true, map[string]any{
+			"id":       a.Id,
+			"name":     a.Name,
+			"worker":   a.Worker,
+			"state":    t.To,
+			"previous": t.From,
+			"lastSeen": a.LastSeen.Format("2006-01-02 15:04:05.000"),
+		})
+	}
+}
+
+// Workers returns the known workers ordered by id, each with its live agents.
+func (f *Fleet) Workers() []WorkerInfo {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]WorkerInfo, 0, len(f.workers))
+	for _, w := range f.workers {
+		out = append(out, WorkerInfo{Id: w.id, Capacity: w.capacity, Agents: f.agentsOf(w.id), LastSeen: w.lastSeen})
+	}
+	slices.SortFunc(out, func(a, b WorkerInfo) int { return cmp.Compare(a.Id, b.Id) })
+	return out
+}
+
+func (f *Fleet) agentsOf(workerId string) []AgentInfo {
+	out := []AgentInfo{}
+	for _, a := range f.agents {
+		if a.Worker == workerId {
+			out = append(out, *a)
+		}
+	}
+	slices.SortFunc(out, func(a, b AgentInfo) int { return a.Id - b.Id })
+	return out
+}
+
+// Agents returns every agent that is not dead, ordered by id.
+func (f *Fleet) Agents() []AgentInfo {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]AgentInfo, 0, len(f.agents))
+	for _, a := range f.agents {
+		out = append(out, *a)
+	}
+	slices.SortFunc(out, func(a, b AgentInfo) int { return a.Id - b.Id })
+	return out
+}
+
+// FreeCapacity is how many more agents the workers can take on. Dead agents
+// hold their slot until their worker's snapshot confirms they are gone.
+func (f *Fleet) FreeCapacity() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	used := make(map[string]int, len(f.workers))
+	for _, a := range f.agents {
+		used[a.Worker]++
+	}
+	for _, worker := range f.dead {
+		used[worker]++
+	}
+	free := 0
+	for _, w := range f.workers {
+		free += max(w.capacity-used[w.id], 0)
+	}
+	return free
+}
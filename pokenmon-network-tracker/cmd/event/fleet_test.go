@@ -0,0 +1,77 @@
+package event
+
+import (
+	"testing"
+	"time"
+)
+
+type discard struct{}
+
+func (discard) Broadcast(string, string, bool, map[string]any) {}
+
+func TestSweepKeepsTheSlotUntilTheWorkerConfirms(t *testing.T) {
+	f := NewFleet(10*time.Millisecond, 20*time.Millisecond)
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 2, Agents: []AgentInfo{{Id: 1, Name: "Jessie"}}})
+	if got := f.FreeCapacity(); got != 1 {
+		t.Fatalf("free capacity = %d, want 1", got)
+	}
+
+	// the worker keeps reporting, the agent has gone quiet
+	time.Sleep(50 * time.Millisecond)
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 2, Agents: []AgentInfo{{Id: 1, Name: "Jessie"}}})
+	dead := f.Sweep(discard{})
+	if len(dead) != 1 || dead[0].Id != 1 || dead[0].Worker != "worker-1" {
+		t.Fatalf("dead = %+v", dead)
+	}
+	if len(f.Agents()) != 0 {
+		t.Errorf("agents = %+v", f.Agents())
+	}
+	if got := f.FreeCapacity(); got != 1 {
+		t.Errorf("free capacity before the worker reaped the agent = %d, want 1", got)
+	}
+
+	// a snapshot still listing the agent does not bring it back
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 2, Agents: []AgentInfo{{Id: 1, Name: "Jessie"}}})
+	if len(f.Agents()) != 0 || f.FreeCapacity() != 1 {
+		t.Errorf("agents = %+v, free capacity = %d", f.Agents(), f.FreeCapacity())
+	}
+
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 2})
+	if got := f.FreeCapacity(); got != 2 {
+		t.Errorf("free capacity after the worker reaped the agent = %d, want 2", got)
+	}
+}
+
+func TestHeartbeatIgnoresAgentsOfUnknownWorkers(t *testing.T) {
+	f := NewFleet(time.Minute, 2*time.Minute)
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 1})
+	f.Remove("worker-1")
+
+	f.Heartbeat(Heartbeat{Agent: AgentInfo{Id: 1, Name: "Jessie", Worker: "worker-1"}})
+	f.Heartbeat(Heartbeat{Agent: AgentInfo{Id: 2, Name: "James", Worker: "worker-2"}})
+	if agents := f.Agents(); len(agents) != 0 {
+		t.Errorf("agents = %+v", agents)
+	}
+
+	f.Update(WorkerInfo{Id: "worker-2", Capacity: 1})
+	f.Heartbeat(Heartbeat{Agent: AgentInfo{Id: 2, Name: "James", Worker: "worker-2"}})
+	if agents := f.Agents(); len(agents) != 1 || agents[0].Id != 2 {
+		t.Errorf("agents = %+v", agents)
+	}
+}
+
+func TestHeartbeatBringsADeadAgentBack(t *testing.T) {
+	f := NewFleet(10*time.Millisecond, 20*time.Millisecond)
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 1, Agents: []AgentInfo{{Id: 1, Name: "Jessie"}}})
+	time.Sleep(50 * time.Millisecond)
+	f.Update(WorkerInfo{Id: "worker-1", Capacity: 1, Agents: []AgentInfo{{Id: 1, Name: "Jessie"}}})
+	f.Sweep(discard{})
+
+	transitions := f.Heartbeat(Heartbeat{Agent: AgentInfo{Id: 1, Name: "Jessie", Worker: "worker-1"}})
+	if len(transitions) != 1 || transitions[0].From != AgentDead || transitions[0].To != AgentAlive {
+		t.Errorf("transitions = %+v", transitions)
+	}
+	if got := f.FreeCapacity(); got != 0 {
+		t.Errorf("free capacity = %d, want 0", got)
+	}
+}
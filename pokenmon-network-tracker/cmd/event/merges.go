@@ -0,0 +1,73 @@
+package event
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// MergedReporters remembers who reported the sightings the dispatcher merged
+// into a capture task after publishing it, as the task itself only carries
+// its first reporter. The task's capture or escape is credited to all of
+// them. It is safe for concurrent use.
+type MergedReporters struct {
+	mu    sync.Mutex
+	tasks map[taskKey]*mergedTask
+	now   func() time.Time
+}
+
+type mergedTask struct {
+	reporters []string
+	seen      time.Time
+}
+
+// Observe records "sighting merged" events and adds the reporters merged into
+// a task to the "pokemon capture" or "pokemon escape" event that finishes it.
+// Tasks neither captured nor expired are forgotten after maxTaskWait.
+func (m *MergedReporters) Observe(messageType string, message map[string]any) {
+	key, ok := taskKeyOf(message)
+	if !ok {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.now == nil {
+		m.now = time.Now
+	}
+	switch messageType {
+	case "sighting merged":
+		if m.tasks == nil {
+			m.tasks = make(map[taskKey]*mergedTask)
+		}
+		now := m.now()
+		for k, t := range m.tasks {
+			if now.Sub(t.seen) > maxTaskWait {
+				delete(m.tasks, k)
+			}
+		}
+		t, ok := m.tasks[key]
+		if !ok {
+			t = &mergedTask{}
+			m.tasks[key] = t
+		}
+		t.seen = now
+		for _, reporter := range texts(message["reporters"]) {
+			if !slices.Contains(t.reporters, reporter) {
+				t.reporters = append(t.reporters, reporter)
+			}
+		}
+	case "pokemon capture", "pokemon escape":
+		t, ok := m.tasks[key]
+		if !ok {
+			return
+		}
+		delete(m.tasks, key)
+		reporters := slices.Clone(texts(message["reporters"]))
+		for _, reporter := range t.reporters {
+			if !slices.Contains(reporters, reporter) {
+				reporters = append(reporters, reporter)
+			}
+		}
+		message["reporters"] = reporters
+	}
+}
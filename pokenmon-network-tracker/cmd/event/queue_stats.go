@@ -4,12 +4,31 @@ import (
 	"github.com/rabbitmq/amqp091-go"
 )
 
+// QueueStats describes a queue's backlog. Messages counts the ready messages.
+// Unacknowledged counts, rates and utilisation come from the management API
+// only; Source tells where the numbers came from.
 type QueueStats struct {
 	Name      string `json:"name"`
 	Messages  int    `json:"messages"`
 	Consumers int    `json:"consumers"`
+
+	MessagesReady          int `json:"messages_ready"`
+	MessagesUnacknowledged int `json:"messages_unacknowledged"`
+	MessagesTotal          int `json:"messages_total"`
+	// PublishRate and AckRate are messages per second.
+	PublishRate         *float64 `json:"publish_rate,omitempty"`
+	AckRate             *float64 `json:"ack_rate,omitempty"`
+	ConsumerUtilisation *float64 `json:"consumer_utilisation,omitempty"`
+	Source              string   `json:"source"`
 }
 
+// Sources of QueueStats.
+const (
+	StatsFromManagement = "management"
+	// StatsFromAMQP cannot see unacknowledged messages, so the total is the ready count.
+	StatsFromAMQP = "amqp"
+)
+
 func GetQueueStats(conn *amqp091.Connection, queueName string) (QueueStats, error) {
 
 	var qs QueueStats
@@ -18,6 +37,7 @@ func GetQueueStats(conn *amqp091.Connection, queueName string) (QueueStats, erro
 	if err != nil {
 		return qs, err
 	}
+	defer ch.Close()
 
 	q, err := ch.QueueDeclarePassive(
 		queueName,
@@ -36,9 +56,12 @@ func GetQueueStats(conn *amqp091.Connection, queueName string) (QueueStats, erro
 	}
 
 	qs = QueueStats{
-		Name:      q.Name,
-		Messages:  q.Messages,
-		Consumers: q.Consumers,
+		Name:          q.Name,
+		Messages:      q.Messages,
+		Consumers:     q.Consumers,
+		MessagesReady: q.Messages,
+		MessagesTotal: q.Messages,
+		Source:        StatsFromAMQP,
 	}
 	return qs, nil
 }
@@ -0,0 +1,62 @@
+package event
+
+import (
+	"pokemonSightingApp/cmd/internal/leaderboard"
+	"time"
+)
+
+// score credits the agents and teams an event is about on board: dispatched and
+// merged sightings go to their reporter, failed attempts and captures to the
+// agent and captures and escapes to the task's reporters.
+func score(board *leaderboard.Board, messageType string, message map[string]any) {
+	at := timestamp(message["at"])
+	if at.IsZero() {
+		at = timestamp(message["dispatchedAt"])
+	}
+	if at.IsZero() {
+		at = time.Now()
+	}
+	reporter, _ := message["reporter"].(string)
+
+	switch messageType {
+	case "headquarter dispatch":
+		if reporter != "" {
+			board.Sighting(at, reporter, false)
+		}
+	case "sighting merged":
+		if reporter != "" {
+			board.Sighting(at, reporter, true)
+		}
+	case "agent log":
+		if message["stage"] == StageFailed {
+			id, _ := number(message["id"])
+			name, _ := message["name"].(string)
+			board.Failure(at, int(id), name)
+		}
+	case "pokemon capture":
+		id, _ := number(message["agentId"])
+		name, _ := message["agent"].(string)
+		pokemon, _ := message["pokemon"].(string)
+		took, _ := number(message["duration"])
+		board.Capture(at, int(id), name, pokemon, time.Duration(took*float64(time.Second)), texts(message["reporters"]))
+	case "pokemon escape":
+		board.Escape(at, texts(message["reporters"]))
+	}
+}
+
+// texts reads a JSON array of strings, or a []string from an event that did not cross the bus.
+func texts(v any) []string {
+	switch list := v.(type) {
+	case []string:
+		return list
+	case []any:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
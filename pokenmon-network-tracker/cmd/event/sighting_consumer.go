@@ -13,22 +13,28 @@ type Sighting struct {
 	Pokemon  string `json:"pokemon"`
 	Location string `json:"location"`
 	Element  string `json:"element"`
+	Reporter string `json:"reporter,omitempty"`
 }
 
+// Elements are the pokemon elements the network routes on.
+var Elements = []string{"fire", "grass", "ghost", "water", "fighting", "lighting"}
+
 type Team struct {
 	Name      string   `json:"name"`
 	Elements  []string `json:"elements"`
 	Topics    []string `json:"topics"`
 	conn      *amqp.Connection
+	exchange  string
 	queueName string
 	b         broadcast.Broadcaster
 }
 
-func NewTeam(conn *amqp.Connection, name string, elements []string, b broadcast.Broadcaster) (Team, error) {
+func NewTeam(conn *amqp.Connection, exchange string, name string, elements []string, b broadcast.Broadcaster) (Team, error) {
 	team := Team{
 		Name:     name,
 		Elements: elements,
 		conn:     conn,
+		exchange: exchange,
 		b:        b,
 	}
 
@@ -55,7 +61,7 @@ func (t *Team) setup() error {
 		return nil
 	}
 
-	err = ch.ExchangeDeclare("pokemon_exchange", "topic", true, false, false, false, nil)
+	err = ch.ExchangeDeclare(t.exchange, "topic", true, false, false, false, nil)
 	if err != nil {
 		return err
 	}
@@ -69,7 +75,7 @@ func (t *Team) setup() error {
 
 	// Bind the queue to exchane
 	for _, topic := range t.Topics {
-		err = ch.QueueBind(q.Name, topic, "pokemon_exchange", false, nil)
+		err = ch.QueueBind(q.Name, topic, t.exchange, false, nil)
 		if err != nil {
 			return err
 		}
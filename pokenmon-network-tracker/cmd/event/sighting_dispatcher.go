@@ -1,9 +1,14 @@
 package event
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"pokemonSightingApp/cmd/internal/broadcast"
@@ -11,90 +16,207 @@ import (
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-var taskId int = 0
-
 type QueueSighting struct {
 	Sighting
 	CaptureTime int `json:"captureTime,omitempty"`
+	// SubmittedAt is when the API accepted the sighting.
+	SubmittedAt time.Time `json:"submittedAt,omitzero"`
+}
+
+// DispatchOptions controls how the dispatcher turns sightings into capture tasks.
+type DispatchOptions struct {
+	Name   string
+	Topics []string
+	// Delay is the pause before each capture task is dispatched.
+	Delay time.Duration
+	// DedupWindow is how long a dispatched task absorbs repeat sightings of the
+	// same pokemon at the same location; 0 disables merging.
+	DedupWindow time.Duration
 }
 
-func DispatchSetup(conn *amqp.Connection, teamName string, topics []string, b broadcast.Broadcaster) error {
+// DispatchSetup starts the dispatcher. Sightings of the same pokemon at the same
+// location within the dedup window are merged into the first task instead of being dispatched again.
+// The returned Consumer reports whether the dispatcher is still consuming and stops it.
+func DispatchSetup(conn *amqp.Connection, topo Topology, opts DispatchOptions, b broadcast.Broadcaster) (*Consumer, error) {
 	ch, err := conn.Channel()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	err = ch.ExchangeDeclare("pokemon_exchange", "topic", true, false, false, false, nil)
+	err = ch.ExchangeDeclare(topo.Exchange, "topic", true, false, false, false, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	q, err := ch.QueueDeclare("sightings_q", true, false, false, false, nil)
+	q, err := ch.QueueDeclare(topo.SightingQueue, true, false, false, false, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = ch.QueueDeclare("pokemon_tasks", true, false, false, false, amqp.Table{
-		"x-dead-letter-exchange":    "",
-		"x-dead-letter-routing-key": "dead_letter_tasks",
-	})
+	_, err = ch.QueueDeclare(topo.TaskQueue, true, false, false, false, topo.taskQueueArgs())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, topic := range topics {
-		err = ch.QueueBind(q.Name, topic, "pokemon_exchange", false, nil)
+	for _, topic := range opts.Topics {
+		err = ch.QueueBind(q.Name, topic, topo.Exchange, false, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	// Consume
-	msgs, err := ch.Consume(q.Name, "", true, false, false, false, nil)
+	tag := "dispatcher-" + opts.Name
+	msgs, err := ch.Consume(q.Name, tag, true, false, false, false, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	go listenDispatch(teamName, msgs, b, conn)
+	consumer := newConsumer(ch, tag)
+	go func() {
+		defer consumer.finish()
+		defer ch.Close()
+		listenDispatch(opts, topo.TaskQueue, msgs, b, conn)
+	}()
 
-	return nil
+	return consumer, nil
 }
 
 type captureTask struct {
 	Sighting
-	TaskId int `json:"taskId"`
+	// Epoch names the dispatcher run that numbered the task, as task ids
+	// start over when the dispatcher restarts.
+	Epoch     string   `json:"epoch,omitempty"`
+	TaskId    int      `json:"taskId"`
+	Reporters []string `json:"reporters,omitempty"`
+	// SubmittedAt is stamped by the API and DispatchedAt by the dispatcher, each
+	// on its own clock; the API times queue waits from the events it receives.
+	SubmittedAt  time.Time `json:"submittedAt,omitzero"`
+	DispatchedAt time.Time `json:"dispatchedAt,omitzero"`
 }
 
-func listenDispatch(dispatcherName string, msgs <-chan amqp.Delivery, b broadcast.Broadcaster, conn *amqp.Connection) {
+// dispatchedTask remembers a recent task so duplicate sightings can be merged into it.
+type dispatchedTask struct {
+	taskId    int
+	reporters []string
+	expires   time.Time
+}
+
+func sightingKey(s Sighting) string {
+	return strings.ToLower(strings.TrimSpace(s.Pokemon)) + "|" + strings.ToLower(strings.TrimSpace(s.Location))
+}
+
+// dedup holds the tasks dispatched within the last window, by sighting key.
+// A zero window merges nothing.
+type dedup struct {
+	window time.Duration
+	recent map[string]*dispatchedTask
+}
+
+func newDedup(window time.Duration) *dedup {
+	return &dedup{window: window, recent: make(map[string]*dispatchedTask)}
+}
+
+// merge folds s into a task dispatched for the same sighting within the
+// window, adding its reporter, and returns that task.
+func (d *dedup) merge(s Sighting, now time.Time) (*dispatchedTask, bool) {
+	for key, t := range d.recent {
+		if now.After(t.expires) {
+			delete(d.recent, key)
+		}
+	}
+	t, ok := d.recent[sightingKey(s)]
+	if !ok {
+		return nil, false
+	}
+	if s.Reporter != "" && !slices.Contains(t.reporters, s.Reporter) {
+		t.reporters = append(t.reporters, s.Reporter)
+	}
+	return t, true
+}
+
+// record opens the window for a task that was published.
+func (d *dedup) record(s Sighting, taskId int, reporters []string, now time.Time) {
+	if d.window <= 0 {
+		return
+	}
+	d.recent[sightingKey(s)] = &dispatchedTask{taskId: taskId, reporters: slices.Clone(reporters), expires: now.Add(d.window)}
+}
+
+func listenDispatch(opts DispatchOptions, taskQueue string, msgs <-chan amqp.Delivery, b broadcast.Broadcaster, conn *amqp.Connection) {
 	ch, err := conn.Channel()
 	if err != nil {
 		return
 	}
 	defer ch.Close()
+
+	// task ids and the recent tasks are owned by this goroutine
+	epoch := newEpoch()
+	taskId := 0
+	recent := newDedup(opts.DedupWindow)
 	for d := range msgs {
 		var s QueueSighting
 		if err := json.Unmarshal(d.Body, &s); err != nil {
 			fmt.Printf("Failed to unmarshal sighting: %v\n", err)
 			continue
 		}
-		time.Sleep(500 * time.Millisecond)
-		msg := fmt.Sprintf("[%s] Dispatch capture task - %s at %s [%s]!", dispatcherName, s.Pokemon, s.Location, s.Element)
-		b.Broadcast(msg, "headquarter dispatch", true, map[string]any{"taskId": taskId})
 
+		now := time.Now()
+		if t, ok := recent.merge(s.Sighting, now); ok {
+			// the API adds these reporters to the task's capture or escape
+			msg := fmt.Sprintf("[%s] Merged duplicate sighting - %s at %s into task %d", opts.Name, s.Pokemon, s.Location, t.taskId)
+			b.Broadcast(msg, "sighting merged", true, map[string]any{
+				"epoch":     epoch,
+				"taskId":    t.taskId,
+				"pokemon":   s.Pokemon,
+				"location":  s.Location,
+				"element":   s.Element,
+				"reporter":  s.Reporter,
+				"reporters": slices.Clone(t.reporters),
+			})
+			continue
+		}
+
+		time.Sleep(opts.Delay)
 		var c captureTask
 
+		c.Epoch = epoch
 		c.TaskId = taskId
 		taskId++
 		c.Sighting = s.Sighting
-		c.publish(s.CaptureTime, ch)
+		c.SubmittedAt = s.SubmittedAt
+		c.DispatchedAt = time.Now()
+		if s.Reporter != "" {
+			c.Reporters = []string{s.Reporter}
+		}
+
+		msg := fmt.Sprintf("[%s] Dispatch capture task - %s at %s [%s]!", opts.Name, s.Pokemon, s.Location, s.Element)
+		dispatch := map[string]any{"epoch": c.Epoch, "taskId": c.TaskId, "element": c.Element, "reporter": s.Reporter, "dispatchedAt": c.DispatchedAt}
+		if !c.SubmittedAt.IsZero() {
+			dispatch["submittedAt"] = c.SubmittedAt
+		}
+		b.Broadcast(msg, "headquarter dispatch", true, dispatch)
+		// a task that never reached the queue must not absorb the sightings repeating it
+		if err := c.publish(taskQueue, s.CaptureTime, ch); err != nil {
+			log.Printf("[%s] Failed to dispatch capture task %d - %s at %s: %v", opts.Name, c.TaskId, s.Pokemon, s.Location, err)
+			continue
+		}
+		recent.record(s.Sighting, c.TaskId, c.Reporters, now)
 	}
 }
 
-func (c *captureTask) publish(duration int, ch *amqp.Channel) error {
+// newEpoch returns a random name for a run of the dispatcher.
+func newEpoch() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (c *captureTask) publish(queue string, duration int, ch *amqp.Channel) error {
 	body, err := json.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("failed to marshal capture task: %w", err)
 	}
 
-	err = ch.Publish("", "pokemon_tasks", false, false, amqp.Publishing{
+	err = ch.Publish("", queue, false, false, amqp.Publishing{
 		ContentType:  "application/json",
 		DeliveryMode: amqp.Persistent,
 		Body:         body,
@@ -0,0 +1,131 @@
+package event
+
+import (
+	"pokemonSightingApp/cmd/internal/leaderboard"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSightingKey(t *testing.T) {
+	a := Sighting{Pokemon: "Pikachu", Location: "Viridian Forest"}
+	for _, b := range []Sighting{
+		{Pokemon: " pikachu ", Location: "VIRIDIAN FOREST"},
+		{Pokemon: "Pikachu", Location: "Viridian Forest", Element: "electric", Reporter: "blue"},
+	} {
+		if sightingKey(a) != sightingKey(b) {
+			t.Errorf("%+v and %+v have different keys", a, b)
+		}
+	}
+	if sightingKey(a) == sightingKey(Sighting{Pokemon: "Pikachu", Location: "Route 1"}) {
+		t.Error("different locations share a key")
+	}
+}
+
+func TestDedup(t *testing.T) {
+	now := time.Now()
+	pikachu := func(reporter string) Sighting {
+		return Sighting{Pokemon: "Pikachu", Location: "Viridian Forest", Reporter: reporter}
+	}
+
+	d := newDedup(time.Minute)
+	if _, ok := d.merge(pikachu("red"), now); ok {
+		t.Fatal("merged into nothing")
+	}
+	d.record(pikachu("red"), 7, []string{"red"}, now)
+
+	for _, reporter := range []string{"blue", "red", "", "green"} {
+		task, ok := d.merge(pikachu(reporter), now.Add(30*time.Second))
+		if !ok || task.taskId != 7 {
+			t.Fatalf("sighting by %q: merged into %+v, %t", reporter, task, ok)
+		}
+	}
+	task, _ := d.merge(pikachu("blue"), now.Add(time.Minute))
+	if !slices.Equal(task.reporters, []string{"red", "blue", "green"}) {
+		t.Errorf("reporters = %v", task.reporters)
+	}
+
+	// the window runs from the dispatch, not from the latest duplicate
+	if task, ok := d.merge(pikachu("blue"), now.Add(time.Minute+time.Second)); ok {
+		t.Errorf("merged into %+v after the window", task)
+	}
+	if len(d.recent) != 0 {
+		t.Errorf("recent = %v", d.recent)
+	}
+}
+
+func TestDedupDisabled(t *testing.T) {
+	now := time.Now()
+	s := Sighting{Pokemon: "Pikachu", Location: "Viridian Forest", Reporter: "red"}
+	d := newDedup(0)
+	d.record(s, 1, []string{"red"}, now)
+	if task, ok := d.merge(s, now); ok {
+		t.Errorf("merged into %+v with no window", task)
+	}
+}
+
+func TestMergedReportersReachTheOutcome(t *testing.T) {
+	now := time.Now()
+	m := &MergedReporters{now: func() time.Time { return now }}
+	merged := func(epoch string, taskId int, reporters ...string) {
+		m.Observe("sighting merged", map[string]any{"epoch": epoch, "taskId": float64(taskId), "reporters": reporters})
+	}
+	merged("e1", 1, "red", "blue")
+	merged("e1", 1, "red", "blue", "green")
+	// the same id from a restarted dispatcher is another task
+	merged("e2", 1, "gold", "silver")
+
+	capture := map[string]any{"epoch": "e1", "taskId": float64(1), "reporters": []any{"red"}}
+	m.Observe("pokemon capture", capture)
+	if got := texts(capture["reporters"]); !slices.Equal(got, []string{"red", "blue", "green"}) {
+		t.Errorf("capture reporters = %v", got)
+	}
+
+	// a task finishes once
+	again := map[string]any{"epoch": "e1", "taskId": float64(1), "reporters": []any{"red"}}
+	m.Observe("pokemon escape", again)
+	if got := texts(again["reporters"]); !slices.Equal(got, []string{"red"}) {
+		t.Errorf("second outcome reporters = %v", got)
+	}
+
+	escape := map[string]any{"epoch": "e2", "taskId": float64(1)}
+	m.Observe("pokemon escape", escape)
+	if got := texts(escape["reporters"]); !slices.Equal(got, []string{"gold", "silver"}) {
+		t.Errorf("escape reporters = %v", got)
+	}
+
+	// a task never finished is forgotten
+	merged("e1", 2, "red", "blue")
+	now = now.Add(maxTaskWait + time.Second)
+	merged("e1", 3, "red", "blue")
+	if len(m.tasks) != 1 {
+		t.Errorf("tasks = %v", m.tasks)
+	}
+}
+
+func TestMergedReportersAreScored(t *testing.T) {
+	board, err := leaderboard.Open(leaderboard.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &MergedReporters{}
+	merge := map[string]any{"epoch": "e1", "taskId": float64(0), "reporter": "blue", "reporters": []any{"red", "blue"}}
+	m.Observe("sighting merged", merge)
+	score(board, "sighting merged", merge)
+	capture := map[string]any{"epoch": "e1", "taskId": float64(0), "agentId": 1, "agent": "Jessie", "pokemon": "Pikachu", "reporters": []any{"red"}}
+	m.Observe("pokemon capture", capture)
+	score(board, "pokemon capture", capture)
+
+	teams, err := board.Teams(leaderboard.All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, team := range teams {
+		if team.Captures != 1 {
+			t.Errorf("team %s captures = %d, want 1", team.Team, team.Captures)
+		}
+	}
+	if len(teams) != 2 {
+		t.Errorf("teams = %+v", teams)
+	}
+}
@@ -0,0 +1,350 @@
+package event
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Stages an agent marks its task logs with, so the SLA tracker can follow each attempt.
+const (
+	StagePickup  = "pickup"
+	StageFailed  = "failed"
+	StageAborted = "aborted"
+)
+
+// Stages an SLA report breaks a capture down into.
+const (
+	// SLAQueued runs from submission to dispatch.
+	SLAQueued = "queued"
+	// SLAPickup runs from dispatch to the first agent picking the task up.
+	SLAPickup = "pickup"
+	// SLAAttempt is a single agent's attempt, whatever its outcome.
+	SLAAttempt = "attempt"
+	// SLACompletion runs from the first pickup to the capture, retries included.
+	SLACompletion = "completion"
+	// SLATotal runs from submission to the capture.
+	SLATotal = "total"
+)
+
+// taskKey names a capture task. Task ids start over when the dispatcher
+// restarts, so they are only unique within the epoch of one dispatcher run.
+type taskKey struct {
+	epoch string
+	id    int
+}
+
+// taskKeyOf reads the task an event is about. Events from a dispatcher that
+// predates epochs all share the empty one.
+func taskKeyOf(message map[string]any) (taskKey, bool) {
+	id, ok := number(message["taskId"])
+	if !ok {
+		return taskKey{}, false
+	}
+	epoch, _ := message["epoch"].(string)
+	return taskKey{epoch: epoch, id: int(id)}, true
+}
+
+type attempt struct {
+	agentId int
+	agent   string
+	start   time.Time
+	end     time.Time
+}
+
+// taskTimes is one capture task's timeline. Zero times were not reported.
+type taskTimes struct {
+	element    string
+	submitted  time.Time
+	dispatched time.Time
+	attempts   []attempt
+	// finished is when the task was captured or expired
+	finished time.Time
+	captured bool
+	// seen is when the task was last heard of
+	seen time.Time
+}
+
+// SLATracker follows capture tasks from submission to capture or expiry
+// through the events the dispatcher, agents and DLQ logger report. Finished
+// tasks are kept for retention, at most maxTasks of them. It is safe for
+// concurrent use.
+type SLATracker struct {
+	mu        sync.Mutex
+	retention time.Duration
+	maxTasks  int
+	open      map[taskKey]*taskTimes
+	// done is in the order the tasks finished; their finish times come from
+	// the agents' clocks, which can skew, so they need not be sorted
+	done []*taskTimes
+}
+
+func NewSLATracker(retention time.Duration, maxTasks int) *SLATracker {
+	return &SLATracker{retention: retention, maxTasks: max(maxTasks, 1), open: make(map[taskKey]*taskTimes)}
+}
+
+// Observe updates the task an event is about. Events without a task id are ignored.
+func (s *SLATracker) Observe(messageType string, message map[string]any) {
+	key, ok := taskKeyOf(message)
+	if !ok {
+		return
+	}
+	at := timestamp(message["at"])
+	if at.IsZero() {
+		at = time.Now()
+	}
+	element, _ := message["element"].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch messageType {
+	case "headquarter dispatch":
+		s.open[key] = &taskTimes{
+			element:    element,
+			submitted:  timestamp(message["submittedAt"]),
+			dispatched: timestamp(message["dispatchedAt"]),
+			seen:       at,
+		}
+	case "agent log":
+		agentId, _ := number(message["id"])
+		switch message["stage"] {
+		case StagePickup:
+			t := s.task(key, element, at)
+			name, _ := message["name"].(string)
+			t.attempts = append(t.attempts, attempt{agentId: int(agentId), agent: name, start: at})
+		case StageFailed, StageAborted:
+			if t, ok := s.open[key]; ok {
+				t.endAttempt(int(agentId), at)
+			}
+		}
+	case "pokemon capture":
+		agentId, _ := number(message["agentId"])
+		t := s.task(key, element, at)
+		t.endAttempt(int(agentId), at)
+		t.captured = true
+		s.finish(key, t, at)
+	case "pokemon escape":
+		s.finish(key, s.task(key, element, at), at)
+	}
+	if len(s.open) > s.maxTasks {
+		s.prune(at)
+	}
+}
+
+// task returns the open task, starting one for tasks dispatched before the tracker.
+func (s *SLATracker) task(key taskKey, element string, at time.Time) *taskTimes {
+	t, ok := s.open[key]
+	if !ok {
+		t = &taskTimes{}
+		s.open[key] = t
+	}
+	if t.element == "" {
+		t.element = element
+	}
+	t.seen = at
+	return t
+}
+
+func (t *taskTimes) endAttempt(agentId int, at time.Time) {
+	for i := len(t.attempts) - 1; i >= 0; i-- {
+		if a := &t.attempts[i]; a.agentId == agentId && a.end.IsZero() {
+			a.end = at
+			return
+		}
+	}
+}
+
+func (s *SLATracker) finish(key taskKey, t *taskTimes, at time.Time) {
+	delete(s.open, key)
+	t.finished = at
+	s.done = append(s.done, t)
+	if len(s.done) > s.maxTasks {
+		s.done = slices.Delete(s.done, 0, len(s.done)-s.maxTasks)
+	}
+}
+
+// prune forgets open tasks not heard of for retention and finished tasks older than it.
+func (s *SLATracker) prune(now time.Time) {
+	cutoff := now.Add(-s.retention)
+	for key, t := range s.open {
+		if t.seen.Before(cutoff) {
+			delete(s.open, key)
+		}
+	}
+	s.done = slices.DeleteFunc(s.done, func(t *taskTimes) bool { return t.finished.Before(cutoff) })
+}
+
+// Latency holds a stage's percentiles in seconds.
+type Latency struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+}
+
+type AgentSLA struct {
+	Id       int                `json:"id"`
+	Name     string             `json:"name"`
+	Attempts int                `json:"attempts"`
+	Captures int                `json:"captures"`
+	Stages   map[string]Latency `json:"stages"`
+}
+
+// SLAReport covers the tasks that were captured or expired since From.
+// Expiries are split by whether any agent had picked the task up; the ratios
+// are of all tasks covered.
+type SLAReport struct {
+	From                      time.Time                     `json:"from"`
+	Tasks                     int                           `json:"tasks"`
+	Captured                  int                           `json:"captured"`
+	Expired                   int                           `json:"expired"`
+	ExpiredBeforePickup       int                           `json:"expiredBeforePickup"`
+	ExpiredWhileRetrying      int                           `json:"expiredWhileRetrying"`
+	ExpiredBeforePickupRatio  float64                       `json:"expiredBeforePickupRatio"`
+	ExpiredWhileRetryingRatio float64                       `json:"expiredWhileRetryingRatio"`
+	InFlight                  int                           `json:"inFlight"`
+	Stages                    map[string]Latency            `json:"stages"`
+	Elements                  map[string]map[string]Latency `json:"elements"`
+	Agents                    []AgentSLA                    `json:"agents"`
+}
+
+// durations collects one group's stage durations.
+type durations map[string][]time.Duration
+
+// add records the time from start to end, skipping stages with an unreported end.
+// Clock skew between the binaries can put end slightly before start.
+func (d durations) add(stage string, start, end time.Time) {
+	if start.IsZero() || end.IsZero() {
+		return
+	}
+	d[stage] = append(d[stage], max(end.Sub(start), 0))
+}
+
+func (d durations) latencies() map[string]Latency {
+	out := make(map[string]Latency, len(d))
+	for stage, ds := range d {
+		slices.Sort(ds)
+		out[stage] = Latency{Count: len(ds), P50: percentile(ds, 0.50), P95: percentile(ds, 0.95), P99: percentile(ds, 0.99)}
+	}
+	return out
+}
+
+// percentile picks the nearest rank from sorted durations, in seconds rounded to the millisecond.
+func percentile(sorted []time.Duration, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	d := sorted[max(i, 0)]
+	return math.Round(d.Seconds()*1000) / 1000
+}
+
+// Report covers the tasks finished within window of now.
+func (s *SLATracker) Report(window time.Duration) SLAReport {
+	now := time.Now()
+	from := now.Add(-window)
+
+	s.mu.Lock()
+	s.prune(now)
+	r := SLAReport{From: from, InFlight: len(s.open)}
+	all := durations{}
+	elements := map[string]durations{}
+	agents := map[int]*AgentSLA{}
+	agentDurations := map[int]durations{}
+	agent := func(a attempt) (*AgentSLA, durations) {
+		if _, ok := agents[a.agentId]; !ok {
+			agents[a.agentId] = &AgentSLA{Id: a.agentId, Name: a.agent}
+			agentDurations[a.agentId] = durations{}
+		}
+		return agents[a.agentId], agentDurations[a.agentId]
+	}
+
+	for _, t := range s.done {
+		if t.finished.Before(from) {
+			continue
+		}
+		r.Tasks++
+		switch {
+		case t.captured:
+			r.Captured++
+		case len(t.attempts) == 0:
+			r.Expired++
+			r.ExpiredBeforePickup++
+		default:
+			r.Expired++
+			r.ExpiredWhileRetrying++
+		}
+
+		if elements[t.element] == nil {
+			elements[t.element] = durations{}
+		}
+		groups := []durations{all, elements[t.element]}
+		for _, d := range groups {
+			d.add(SLAQueued, t.submitted, t.dispatched)
+		}
+		for i, a := range t.attempts {
+			info, byAgent := agent(a)
+			info.Attempts++
+			for _, d := range append(groups, byAgent) {
+				if i == 0 {
+					d.add(SLAPickup, t.dispatched, a.start)
+				}
+				d.add(SLAAttempt, a.start, a.end)
+			}
+		}
+		if !t.captured {
+			continue
+		}
+		var first time.Time
+		if len(t.attempts) > 0 {
+			first = t.attempts[0].start
+			info, byAgent := agent(t.attempts[len(t.attempts)-1])
+			info.Captures++
+			byAgent.add(SLATotal, t.submitted, t.finished)
+		}
+		for _, d := range groups {
+			d.add(SLACompletion, first, t.finished)
+			d.add(SLATotal, t.submitted, t.finished)
+		}
+	}
+	s.mu.Unlock()
+
+	if r.Tasks > 0 {
+		r.ExpiredBeforePickupRatio = float64(r.ExpiredBeforePickup) / float64(r.Tasks)
+		r.ExpiredWhileRetryingRatio = float64(r.ExpiredWhileRetrying) / float64(r.Tasks)
+	}
+	r.Stages = all.latencies()
+	r.Elements = make(map[string]map[string]Latency, len(elements))
+	for element, d := range elements {
+		r.Elements[element] = d.latencies()
+	}
+	r.Agents = make([]AgentSLA, 0, len(agents))
+	for id, a := range agents {
+		a.Stages = agentDurations[id].latencies()
+		r.Agents = append(r.Agents, *a)
+	}
+	slices.SortFunc(r.Agents, func(a, b AgentSLA) int { return cmp.Compare(a.Id, b.Id) })
+	return r
+}
+
+// number reads a JSON number, or an int from an event that did not cross the bus.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// timestamp reads an RFC 3339 time, or a time.Time from an event that did not cross the bus.
+func timestamp(v any) time.Time {
+	switch t := v.(type) {
+	case time.Time:
+		return t
+	case string:
+		parsed, _ := time.Parse(time.RFC3339Nano, t)
+		return parsed
+	}
+	return time.Time{}
+}
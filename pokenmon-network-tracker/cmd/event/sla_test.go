@@ -0,0 +1,180 @@
+package event
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	seconds := func(n ...int) []time.Duration {
+		out := make([]time.Duration, len(n))
+		for i, s := range n {
+			out[i] = time.Duration(s) * time.Second
+		}
+		return out
+	}
+	tests := []struct {
+		name   string
+		sorted []time.Duration
+		p      float64
+		want   float64
+	}{
+		{"single", seconds(4), 0.99, 4},
+		{"median of odd", seconds(1, 2, 3, 4, 5), 0.50, 3},
+		{"median of even picks the lower", seconds(1, 2, 3, 4), 0.50, 2},
+		{"p95 of ten is the last", seconds(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 0.95, 10},
+		{"p90 of ten", seconds(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), 0.90, 9},
+		{"zero percentile is the first", seconds(1, 2, 3), 0, 1},
+		{"rounded to the millisecond", []time.Duration{1234567 * time.Microsecond}, 0.5, 1.235},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := percentile(tt.sorted, tt.p); got != tt.want {
+				t.Errorf("percentile(%v, %g) = %g, want %g", tt.sorted, tt.p, got, tt.want)
+			}
+		})
+	}
+}
+
+// timeline feeds a tracker the events of capture tasks, each at a given
+// number of seconds after start.
+type timeline struct {
+	s     *SLATracker
+	start time.Time
+}
+
+func (tl timeline) at(seconds int) time.Time {
+	return tl.start.Add(time.Duration(seconds) * time.Second)
+}
+
+func (tl timeline) dispatch(epoch string, taskId, submitted, dispatched int) {
+	tl.s.Observe("headquarter dispatch", map[string]any{
+		"epoch": epoch, "taskId": taskId, "element": "fire",
+		"submittedAt": tl.at(submitted), "dispatchedAt": tl.at(dispatched), "at": tl.at(dispatched),
+	})
+}
+
+func (tl timeline) agent(epoch string, taskId, agentId int, stage string, at int) {
+	tl.s.Observe("agent log", map[string]any{
+		"epoch": epoch, "taskId": taskId, "id": agentId, "name": "agent " + strconv.Itoa(agentId), "element": "fire", "stage": stage, "at": tl.at(at),
+	})
+}
+
+func (tl timeline) capture(epoch string, taskId, agentId, at int) {
+	tl.s.Observe("pokemon capture", map[string]any{"epoch": epoch, "taskId": taskId, "agentId": agentId, "element": "fire", "at": tl.at(at)})
+}
+
+func (tl timeline) escape(epoch string, taskId, at int) {
+	tl.s.Observe("pokemon escape", map[string]any{"epoch": epoch, "taskId": taskId, "element": "fire", "at": tl.at(at)})
+}
+
+func TestSLAStages(t *testing.T) {
+	tl := timeline{s: NewSLATracker(time.Hour, 100), start: time.Now().Add(-10 * time.Minute)}
+
+	// picked up by a, failed, retried by b and captured
+	tl.dispatch("e1", 0, 0, 2)
+	tl.agent("e1", 0, 1, StagePickup, 5)
+	tl.agent("e1", 0, 1, StageFailed, 9)
+	tl.agent("e1", 0, 2, StagePickup, 10)
+	tl.capture("e1", 0, 2, 16)
+	// expired before anyone picked it up
+	tl.dispatch("e1", 1, 20, 21)
+	tl.escape("e1", 1, 60)
+	// expired while b retried it
+	tl.dispatch("e1", 2, 30, 30)
+	tl.agent("e1", 2, 2, StagePickup, 31)
+	tl.agent("e1", 2, 2, StageAborted, 33)
+	tl.escape("e1", 2, 70)
+	// still in flight
+	tl.dispatch("e1", 3, 80, 80)
+
+	r := tl.s.Report(time.Hour)
+	if r.Tasks != 3 || r.Captured != 1 || r.ExpiredBeforePickup != 1 || r.ExpiredWhileRetrying != 1 || r.InFlight != 1 {
+		t.Errorf("report = %+v", r)
+	}
+	want := map[string]Latency{
+		SLAQueued:     {Count: 3, P50: 1, P95: 2, P99: 2},
+		SLAPickup:     {Count: 2, P50: 1, P95: 3, P99: 3},
+		SLAAttempt:    {Count: 3, P50: 4, P95: 6, P99: 6},
+		SLACompletion: {Count: 1, P50: 11, P95: 11, P99: 11},
+		SLATotal:      {Count: 1, P50: 16, P95: 16, P99: 16},
+	}
+	for stage, l := range want {
+		if r.Stages[stage] != l {
+			t.Errorf("%s = %+v, want %+v", stage, r.Stages[stage], l)
+		}
+	}
+	if r.Elements["fire"][SLATotal] != want[SLATotal] {
+		t.Errorf("fire total = %+v", r.Elements["fire"][SLATotal])
+	}
+
+	if len(r.Agents) != 2 {
+		t.Fatalf("agents = %+v", r.Agents)
+	}
+	a, b := r.Agents[0], r.Agents[1]
+	if a.Id != 1 || a.Attempts != 1 || a.Captures != 0 || a.Stages[SLAAttempt].P50 != 4 {
+		t.Errorf("agent a = %+v", a)
+	}
+	if b.Id != 2 || b.Attempts != 2 || b.Captures != 1 || b.Stages[SLATotal].P50 != 16 {
+		t.Errorf("agent b = %+v", b)
+	}
+}
+
+func TestSLAKeepsTasksApartAcrossDispatcherRestarts(t *testing.T) {
+	tl := timeline{s: NewSLATracker(time.Hour, 100), start: time.Now().Add(-10 * time.Minute)}
+
+	tl.dispatch("e1", 0, 0, 1)
+	tl.agent("e1", 0, 1, StagePickup, 2)
+	// the dispatcher restarts and numbers its first task 0 again
+	tl.dispatch("e2", 0, 10, 11)
+	tl.capture("e1", 0, 1, 20)
+	tl.agent("e2", 0, 2, StagePickup, 21)
+	tl.capture("e2", 0, 2, 25)
+
+	r := tl.s.Report(time.Hour)
+	if r.Captured != 2 || r.InFlight != 0 {
+		t.Errorf("report = %+v", r)
+	}
+	if total := r.Stages[SLATotal]; total.Count != 2 || total.P50 != 15 || total.P99 != 20 {
+		t.Errorf("total = %+v", total)
+	}
+	if pickup := r.Stages[SLAPickup]; pickup.Count != 2 || pickup.P99 != 10 {
+		t.Errorf("pickup = %+v", pickup)
+	}
+}
+
+func TestSLAWindowAndRetention(t *testing.T) {
+	tl := timeline{s: NewSLATracker(time.Hour, 2), start: time.Now().Add(-2 * time.Hour)}
+	// finished before the retention
+	tl.dispatch("e1", 0, 0, 0)
+	tl.escape("e1", 0, 10)
+	tl.start = time.Now().Add(-time.Minute)
+	for id := 1; id <= 3; id++ {
+		tl.dispatch("e1", id, 0, 0)
+		tl.escape("e1", id, id)
+	}
+
+	// only the newest maxTasks are kept
+	if r := tl.s.Report(time.Hour); r.Tasks != 2 {
+		t.Errorf("tasks = %d, want 2", r.Tasks)
+	}
+	if r := tl.s.Report(time.Second); r.Tasks != 0 {
+		t.Errorf("tasks in the last second = %d, want 0", r.Tasks)
+	}
+}
+
+func TestSLARetentionWithSkewedClocks(t *testing.T) {
+	tl := timeline{s: NewSLATracker(time.Hour, 10), start: time.Now()}
+	// the middle task's finish time comes from a clock two hours behind
+	tl.dispatch("e1", 0, -60, -60)
+	tl.escape("e1", 0, -50)
+	tl.dispatch("e1", 1, -7200, -7200)
+	tl.escape("e1", 1, -7190)
+	tl.dispatch("e1", 2, -40, -40)
+	tl.escape("e1", 2, -30)
+
+	if r := tl.s.Report(24 * time.Hour); r.Tasks != 2 {
+		t.Errorf("tasks = %d, want the 2 finished within the retention", r.Tasks)
+	}
+}
@@ -0,0 +1,49 @@
+package event
+
+import (
+	"context"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Consumer is a long-running consumer goroutine: the dispatcher, the dead letter logger or the API's event bus.
+type Consumer struct {
+	running atomic.Bool
+	ch      *amqp.Channel
+	tag     string
+	done    chan struct{}
+}
+
+func newConsumer(ch *amqp.Channel, tag string) *Consumer {
+	c := &Consumer{ch: ch, tag: tag, done: make(chan struct{})}
+	c.running.Store(true)
+	return c
+}
+
+// Running reports whether the consumer goroutine is still going.
+func (c *Consumer) Running() bool {
+	return c != nil && c.running.Load()
+}
+
+func (c *Consumer) finish() {
+	c.running.Store(false)
+	close(c.done)
+}
+
+// Stop cancels the consumer and waits until the deliveries it already
+// received are handled, or ctx is done.
+func (c *Consumer) Stop(ctx context.Context) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.ch.Cancel(c.tag, false); err != nil && c.Running() {
+		return err
+	}
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,82 @@
+package event
+
+import (
+	"fmt"
+	"pokemonSightingApp/cmd/internal/config"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Topology names the exchange and queues the pipeline runs on.
+type Topology struct {
+	Exchange        string
+	SightingQueue   string
+	TaskQueue       string
+	DeadLetterQueue string
+	// EventExchange carries events and status from the workers to the API.
+	EventExchange string
+	// ControlExchange carries agent commands from the API to the workers.
+	ControlExchange string
+	SpawnQueue      string
+}
+
+func TopologyOf(c config.Broker) Topology {
+	return Topology{
+		Exchange:        c.Exchange,
+		SightingQueue:   c.SightingQueue,
+		TaskQueue:       c.TaskQueue,
+		DeadLetterQueue: c.DeadLetterQueue,
+		EventExchange:   c.EventExchange,
+		ControlExchange: c.ControlExchange,
+		SpawnQueue:      c.SpawnQueue,
+	}
+}
+
+// Queues lists the pipeline's durable queues in the order work flows through them.
+func (t Topology) Queues() []string {
+	return []string{t.SightingQueue, t.TaskQueue, t.DeadLetterQueue, t.SpawnQueue}
+}
+
+// taskQueueArgs dead-letters expired and rejected capture tasks.
+func (t Topology) taskQueueArgs() amqp.Table {
+	return amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": t.DeadLetterQueue,
+	}
+}
+
+// CheckTopology confirms the exchange and queues the pipeline relies on have been declared.
+func CheckTopology(conn *amqp.Connection, topo Topology) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	// a failed passive declare closes the channel, so stop at the first one
+	for _, name := range []string{topo.Exchange, topo.EventExchange, topo.ControlExchange} {
+		if err := ch.ExchangeDeclarePassive(name, "topic", true, false, false, false, nil); err != nil {
+			return fmt.Errorf("exchange %s: %w", name, err)
+		}
+	}
+	for _, name := range []string{topo.SightingQueue, topo.TaskQueue, topo.DeadLetterQueue, topo.SpawnQueue} {
+		if _, err := ch.QueueDeclarePassive(name, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("queue %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// declareFleet declares the exchanges and the spawn queue the API and the
+// agent workers talk over. Both sides call it so either can start first.
+func declareFleet(ch *amqp.Channel, topo Topology) error {
+	for _, name := range []string{topo.EventExchange, topo.ControlExchange} {
+		if err := ch.ExchangeDeclare(name, "topic", true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+	if _, err := ch.QueueDeclare(topo.SpawnQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+	return ch.QueueBind(topo.SpawnQueue, SpawnKey, topo.ControlExchange, false, nil)
+}
@@ -0,0 +1,292 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Worker runs rocket agents on behalf of the API. It takes spawn commands from
+// the shared spawn queue while it has room and stop/announce commands from a
+// queue of its own, and reports a snapshot of its agents on the event exchange
+// after every change and on every heartbeat interval.
+type Worker struct {
+	Id       string
+	capacity int
+	conn     *amqp.Connection
+	topo     Topology
+	work     AgentOptions
+	agents   *AgentRegistry
+	bus      *BusBroadcaster
+	ch       *amqp.Channel
+	spawnTag string
+	tags     []string
+	// freed wakes the run loop when a crashed agent gave up its slot
+	freed chan struct{}
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+func NewWorker(conn *amqp.Connection, topo Topology, work AgentOptions, id string, capacity int, bus *BusBroadcaster) *Worker {
+	work.Worker = id
+	work.Heartbeats = bus
+	return &Worker{
+		Id:       id,
+		capacity: capacity,
+		conn:     conn,
+		topo:     topo,
+		work:     work,
+		agents:   NewAgentRegistry(),
+		bus:      bus,
+		freed:    make(chan struct{}, 1),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start registers the worker and begins taking commands.
+func (w *Worker) Start() error {
+	ch, err := w.conn.Channel()
+	if err != nil {
+		return err
+	}
+	if err := declareFleet(ch, w.topo); err != nil {
+		ch.Close()
+		return err
+	}
+	// one spawn at a time so a full worker leaves the rest to the others
+	if err := ch.Qos(1, 0, false); err != nil {
+		ch.Close()
+		return err
+	}
+
+	spawnTag := "worker-" + w.Id + "-spawn"
+	spawns, err := ch.Consume(w.topo.SpawnQueue, spawnTag, false, false, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+
+	q, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+	for _, key := range []string{StopKey, DrainKey, ReapKey, announceKey} {
+		if err := ch.QueueBind(q.Name, key, w.topo.ControlExchange, false, nil); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+	controlTag := "worker-" + w.Id + "-control"
+	controls, err := ch.Consume(q.Name, controlTag, true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return err
+	}
+
+	w.ch = ch
+	w.spawnTag = spawnTag
+	w.tags = []string{spawnTag, controlTag}
+	go w.run(spawns, controls)
+
+	w.report()
+	w.bus.Broadcast(fmt.Sprintf("Agent worker %s online with room for %d agents", w.Id, w.capacity), "agent log", true, map[string]any{"worker": w.Id})
+	return nil
+}
+
+func (w *Worker) run(spawns, controls <-chan amqp.Delivery) {
+	defer close(w.done)
+	ticker := time.NewTicker(w.work.HeartbeatInterval)
+	defer ticker.Stop()
+
+	// A full worker cancels its spawn consumer so the queue hands the commands
+	// to workers with room, and consumes again once an agent has left. spawns
+	// stays set after the cancel until the deliveries in flight are handed over.
+	consuming := true
+	fit := func() {
+		full := w.agents.Count() >= w.capacity
+		switch {
+		case full && consuming:
+			if err := w.ch.Cancel(w.spawnTag, false); err != nil {
+				log.Printf("failed to pause spawn commands: %v", err)
+				return
+			}
+			consuming = false
+		case !full && !consuming && spawns == nil:
+			d, err := w.ch.Consume(w.topo.SpawnQueue, w.spawnTag, false, false, false, false, nil)
+			if err != nil {
+				log.Printf("failed to resume spawn commands: %v", err)
+				return
+			}
+			spawns, consuming = d, true
+		}
+	}
+	fit()
+
+	for spawns != nil || controls != nil {
+		select {
+		case <-w.quit:
+			return
+		case <-ticker.C:
+			// the snapshot doubles as the worker's own heartbeat
+			w.report()
+		case <-w.freed:
+		case d, ok := <-spawns:
+			if !ok {
+				spawns = nil
+				consuming = false
+				break
+			}
+			w.spawn(&d)
+		case d, ok := <-controls:
+			if !ok {
+				controls = nil
+				continue
+			}
+			switch d.RoutingKey {
+			case StopKey:
+				w.agents.StopAll(context.Background())
+				w.report()
+			case DrainKey:
+				w.drain(d.Body)
+			case ReapKey:
+				w.reap(d.Body)
+			case announceKey:
+				w.report()
+			}
+		}
+		fit()
+	}
+}
+
+func (w *Worker) spawn(d *amqp.Delivery) {
+	var a AgentInfo
+	if err := json.Unmarshal(d.Body, &a); err != nil {
+		log.Printf("Failed to unmarshal spawn command: %v", err)
+		d.Nack(false, false)
+		return
+	}
+	if w.agents.Count() >= w.capacity {
+		// delivered before the consumer was paused; say so rather than bounce it
+		d.Nack(false, false)
+		w.bus.Broadcast(fmt.Sprintf("Agent worker %s is full and turned down rocket agent %d, %s", w.Id, a.Id, a.Name), "agent rejected", true, map[string]any{"worker": w.Id, "id": a.Id, "name": a.Name, "imageNum": a.ImageNum})
+		return
+	}
+
+	agent, err := NewRocketAgent(w.conn, w.topo, w.work, a.Id, a.Name, a.ImageNum, w.bus)
+	if err == nil {
+		err = agent.Listen()
+	}
+	if err != nil {
+		log.Printf("agent %d failed to start: %v", a.Id, err)
+		w.bus.Broadcast(fmt.Sprintf("Agent worker %s failed to start rocket agent %d, %s", w.Id, a.Id, a.Name), "agent log", true, map[string]any{"worker": w.Id, "id": a.Id, "name": a.Name})
+		d.Nack(false, false)
+		return
+	}
+	w.agents.Add(agent)
+	d.Ack(false)
+	w.report()
+	go w.watch(agent)
+}
+
+// watch drops an agent whose task consumer died so its slot is freed;
+// the API notices from the missing heartbeats and the next snapshot.
+func (w *Worker) watch(agent *RocketAgent) {
+	<-agent.Done()
+	if !agent.Crashed() {
+		return
+	}
+	w.agents.Remove(agent.Id)
+	w.report()
+	select {
+	case w.freed <- struct{}{}:
+	default:
+	}
+	w.bus.Broadcast(fmt.Sprintf("Rocket agent %d, %s on agent worker %s lost its task consumer", agent.Id, agent.Name, w.Id), "agent log", true, map[string]any{"worker": w.Id, "id": agent.Id, "name": agent.Name})
+}
+
+// drain stops one agent if it runs on this worker. The agent finishes its
+// current task in the background while the worker carries on.
+func (w *Worker) drain(body []byte) {
+	var a AgentInfo
+	if err := json.Unmarshal(body, &a); err != nil {
+		log.Printf("Failed to unmarshal drain command: %v", err)
+		return
+	}
+	agent := w.find(a.Id)
+	if agent == nil {
+		return
+	}
+
+	w.agents.Remove(agent.Id)
+	w.report()
+	go agent.Stop()
+}
+
+// reap stops an agent the API declared dead if it still runs on this worker,
+// handing its current task back straight away. The worker reports either way,
+// which confirms to the API that the agent's slot is free.
+func (w *Worker) reap(body []byte) {
+	var a AgentInfo
+	if err := json.Unmarshal(body, &a); err != nil {
+		log.Printf("Failed to unmarshal reap command: %v", err)
+		return
+	}
+	if a.Worker != w.Id {
+		return
+	}
+	if agent := w.find(a.Id); agent != nil {
+		w.agents.Remove(agent.Id)
+		abandon, cancel := context.WithCancel(context.Background())
+		cancel()
+		go agent.StopContext(abandon)
+	}
+	w.report()
+}
+
+func (w *Worker) find(id int) *RocketAgent {
+	for _, r := range w.agents.List() {
+		if r.Id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (w *Worker) info() WorkerInfo {
+	info := WorkerInfo{Id: w.Id, Capacity: w.capacity, Agents: []AgentInfo{}}
+	for _, a := range w.agents.List() {
+		info.Agents = append(info.Agents, AgentInfo{Id: a.Id, Name: a.Name, ImageNum: a.ImageNum, Worker: w.Id})
+	}
+	return info
+}
+
+func (w *Worker) report() {
+	if err := w.bus.publish(workerKey, w.info()); err != nil {
+		log.Printf("failed to report worker status: %v", err)
+	}
+}
+
+// Shutdown stops taking commands, stops the agents and deregisters the worker.
+// Agents still busy when ctx is done hand their task back to the queue.
+func (w *Worker) Shutdown(ctx context.Context) error {
+	close(w.quit)
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+	}
+	// spawn commands delivered but not taken go back to the queue when ch closes
+	for _, tag := range w.tags {
+		_ = w.ch.Cancel(tag, false)
+	}
+	w.agents.StopAll(ctx)
+
+	err := w.bus.publish(workerDownKey, WorkerInfo{Id: w.Id, Capacity: w.capacity, Agents: []AgentInfo{}})
+	w.ch.Close()
+	return err
+}
@@ -0,0 +1,234 @@
+// Package alert evaluates declarative rules against metric samples and tracks
+// which alerts are firing. Rules read like
+//
+//	tasks_backlog: queue.pokemon_tasks.ready > 50 for 1m
+//
+// with an optional name, one of > >= < <= == != and an optional hold time
+// the condition must last before the alert fires. Thresholds may be given in
+// percent, 20% being 0.2.
+package alert
+
+import (
+	"errors"
+	"fmt"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/history"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alert states. Pending alerts hold but have not lasted long enough to fire.
+// NoData alerts had no value in the latest sample.
+const (
+	Inactive = "inactive"
+	Pending  = "pending"
+	Firing   = "firing"
+	Resolved = "resolved"
+	NoData   = "nodata"
+)
+
+var ops = []string{">=", "<=", "==", "!=", ">", "<"}
+
+type Rule struct {
+	Name      string
+	Metric    string
+	Op        string
+	Threshold float64
+	For       time.Duration
+	// Expr is the rule as written, without its name.
+	Expr string
+}
+
+// ParseRule reads a rule such as "escape_rate: escapes.ratio > 20% for 1m".
+func ParseRule(raw string) (Rule, error) {
+	var r Rule
+	expr := strings.TrimSpace(raw)
+	if name, rest, ok := strings.Cut(expr, ":"); ok {
+		r.Name, expr = strings.TrimSpace(name), strings.TrimSpace(rest)
+	}
+	r.Expr = expr
+
+	if cond, hold, ok := strings.Cut(expr, " for "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(hold))
+		if err != nil || d < 0 {
+			return r, fmt.Errorf("rule %q: invalid hold time %q", raw, strings.TrimSpace(hold))
+		}
+		r.For, expr = d, cond
+	}
+
+	for _, op := range ops {
+		metric, threshold, ok := strings.Cut(expr, op)
+		if !ok {
+			continue
+		}
+		r.Metric, r.Op = strings.TrimSpace(metric), op
+		threshold = strings.TrimSpace(threshold)
+		scale := 1.0
+		if t, ok := strings.CutSuffix(threshold, "%"); ok {
+			threshold, scale = t, 0.01
+		}
+		v, err := strconv.ParseFloat(threshold, 64)
+		if err != nil {
+			return r, fmt.Errorf("rule %q: invalid threshold %q", raw, threshold)
+		}
+		r.Threshold = v * scale
+		break
+	}
+	if r.Op == "" || r.Metric == "" || strings.ContainsAny(r.Metric, " \t") {
+		return r, fmt.Errorf("rule %q: want [name:] metric op threshold [for duration]", raw)
+	}
+	if r.Name == "" {
+		r.Name = r.Expr
+	}
+	return r, nil
+}
+
+// ParseRules parses every rule and rejects duplicate names and metrics that
+// are not among metrics.
+func ParseRules(raw []string, metrics []string) ([]Rule, error) {
+	var rules []Rule
+	var errs []error
+	seen := make(map[string]bool)
+	for _, s := range raw {
+		r, err := ParseRule(s)
+		switch {
+		case err != nil:
+			errs = append(errs, err)
+		case seen[r.Name]:
+			errs = append(errs, fmt.Errorf("rule %q: name %s is used twice", s, r.Name))
+		case !slices.Contains(metrics, r.Metric):
+			errs = append(errs, fmt.Errorf("rule %q: unknown metric %s, known metrics: %s", s, r.Metric, strings.Join(metrics, ", ")))
+		default:
+			seen[r.Name] = true
+			rules = append(rules, r)
+		}
+	}
+	return rules, errors.Join(errs...)
+}
+
+func (r Rule) holds(v float64) bool {
+	switch r.Op {
+	case ">":
+		return v > r.Threshold
+	case ">=":
+		return v >= r.Threshold
+	case "<":
+		return v < r.Threshold
+	case "<=":
+		return v <= r.Threshold
+	case "==":
+		return v == r.Threshold
+	default:
+		return v != r.Threshold
+	}
+}
+
+// Alert is the state of one rule.
+type Alert struct {
+	Rule   string `json:"rule"`
+	Expr   string `json:"expr"`
+	Metric string `json:"metric"`
+	State  string `json:"state"`
+	// Value is the metric when the rule was last evaluated.
+	Value *float64 `json:"value,omitempty"`
+	// Since is when the alert entered its current state.
+	Since      time.Time `json:"since,omitzero"`
+	FiredAt    time.Time `json:"firedAt,omitzero"`
+	ResolvedAt time.Time `json:"resolvedAt,omitzero"`
+}
+
+// Engine evaluates its rules against every sample it is given.
+// It is safe for concurrent use.
+type Engine struct {
+	mu     sync.RWMutex
+	rules  []Rule
+	alerts map[string]*Alert
+}
+
+func NewEngine(rules []Rule) *Engine {
+	e := &Engine{rules: rules, alerts: make(map[string]*Alert)}
+	for _, r := range rules {
+		e.alerts[r.Name] = &Alert{Rule: r.Name, Expr: r.Expr, Metric: r.Metric, State: Inactive}
+	}
+	return e
+}
+
+// Evaluate moves each rule's alert along with sample and announces every
+// alert that fires or resolves on b. An alert whose metric the sample lacks,
+// such as a queue stat during a broker outage, turns NoData; a firing one is
+// announced, as it no longer knows whether it holds.
+func (e *Engine) Evaluate(sample history.Sample, b broadcast.Broadcaster) {
+	now := sample.Time
+	var changed []Alert
+
+	e.mu.Lock()
+	for _, r := range e.rules {
+		a := e.alerts[r.Name]
+		v, ok := sample.Values[r.Metric]
+		if !ok {
+			if a.State != NoData {
+				firing := a.State == Firing
+				a.State, a.Since, a.Value = NoData, now, nil
+				if firing {
+					changed = append(changed, *a)
+				}
+			}
+			continue
+		}
+		a.Value = &v
+
+		if r.holds(v) {
+			if a.State == Inactive || a.State == Resolved || a.State == NoData {
+				a.State, a.Since = Pending, now
+			}
+			if a.State == Pending && now.Sub(a.Since) >= r.For {
+				a.State, a.Since, a.FiredAt = Firing, now, now
+				changed = append(changed, *a)
+			}
+			continue
+		}
+		switch a.State {
+		case Pending, NoData:
+			a.State, a.Since = Inactive, now
+		case Firing:
+			a.State, a.Since, a.ResolvedAt = Resolved, now, now
+			changed = append(changed, *a)
+		}
+	}
+	e.mu.Unlock()
+
+	for _, a := range changed {
+		msg := fmt.Sprintf("Alert %s %s: %s (no value for %s)", a.Rule, a.State, a.Expr, a.Metric)
+		options := map[string]any{
+			"rule":    a.Rule,
+			"expr":    a.Expr,
+			"metric":  a.Metric,
+			"state":   a.State,
+			"firedAt": a.FiredAt.Format(time.RFC3339),
+		}
+		if a.Value != nil {
+			msg = fmt.Sprintf("Alert %s %s: %s (value %g)", a.Rule, a.State, a.Expr, *a.Value)
+			options["value"] = *a.Value
+		}
+		b.Broadcast(msg, "alert", true, options)
+	}
+}
+
+// Alerts returns every rule's alert in the order the rules were given.
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make([]Alert, 0, len(e.rules))
+	for _, r := range e.rules {
+		a := *e.alerts[r.Name]
+		if a.Value != nil {
+			v := *a.Value
+			a.Value = &v
+		}
+		out = append(out, a)
+	}
+	return out
+}
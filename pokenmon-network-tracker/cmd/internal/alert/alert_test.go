@@ -0,0 +1,102 @@
+package alert
+
+import (
+	"pokemonSightingApp/cmd/internal/history"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder keeps the state of every alert broadcast.
+type recorder struct{ states []string }
+
+func (r *recorder) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	r.states = append(r.states, options["state"].(string))
+}
+
+func TestParseRules(t *testing.T) {
+	metrics := []string{"escapes.ratio", "queue.pokemon_tasks.ready"}
+	rules, err := ParseRules([]string{"escape_rate: escapes.ratio > 20% for 1m", "queue.pokemon_tasks.ready >= 5"}, metrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules[0].Threshold != 0.2 || rules[0].For != time.Minute || rules[1].Name != "queue.pokemon_tasks.ready >= 5" {
+		t.Errorf("rules = %+v", rules)
+	}
+
+	tests := []struct {
+		name string
+		raw  []string
+		want string
+	}{
+		{"unknown metric", []string{"queue.pokemon_task.ready > 5"}, "unknown metric queue.pokemon_task.ready"},
+		{"duplicate name", []string{"a: escapes.ratio > 1", "a: escapes.ratio < 1"}, "name a is used twice"},
+		{"no operator", []string{"escapes.ratio 5"}, "want [name:] metric op threshold"},
+		{"bad hold time", []string{"escapes.ratio > 1 for soon"}, "invalid hold time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRules(tt.raw, metrics)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules, err := ParseRules([]string{"backlog: ready > 10 for 1m"}, []string{"ready"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(rules)
+	start := time.Unix(0, 0)
+	b := &recorder{}
+
+	steps := []struct {
+		after  time.Duration
+		values map[string]float64
+		state  string
+	}{
+		{0, map[string]float64{"ready": 20}, Pending},
+		{30 * time.Second, map[string]float64{"ready": 20}, Pending},
+		{time.Minute, map[string]float64{"ready": 20}, Firing},
+		{90 * time.Second, nil, NoData},
+		{2 * time.Minute, map[string]float64{"ready": 20}, Pending},
+		{150 * time.Second, map[string]float64{"ready": 5}, Inactive},
+		{3 * time.Minute, nil, NoData},
+		{210 * time.Second, map[string]float64{"ready": 5}, Inactive},
+	}
+	for i, step := range steps {
+		e.Evaluate(history.Sample{Time: start.Add(step.after), Values: step.values}, b)
+		a := e.Alerts()[0]
+		if a.State != step.state {
+			t.Fatalf("step %d: state = %s, want %s", i, a.State, step.state)
+		}
+		if (a.Value == nil) != (step.state == NoData) {
+			t.Errorf("step %d: value = %v", i, a.Value)
+		}
+	}
+	// only leaving firing for no data is announced, not the quiet nodata
+	if got := strings.Join(b.states, ","); got != "firing,nodata" {
+		t.Errorf("announced %s", got)
+	}
+}
+
+func TestEvaluateResolves(t *testing.T) {
+	rules, err := ParseRules([]string{"ready > 10"}, []string{"ready"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(rules)
+	b := &recorder{}
+	e.Evaluate(history.Sample{Time: time.Unix(0, 0), Values: map[string]float64{"ready": 20}}, b)
+	e.Evaluate(history.Sample{Time: time.Unix(10, 0), Values: map[string]float64{"ready": 0}}, b)
+	a := e.Alerts()[0]
+	if a.State != Resolved || !a.ResolvedAt.Equal(time.Unix(10, 0)) {
+		t.Errorf("alert = %+v", a)
+	}
+	if got := strings.Join(b.states, ","); got != "firing,resolved" {
+		t.Errorf("announced %s", got)
+	}
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Role string
+
+const (
+	Observer         Role = "observer"
+	SightingReporter Role = "sighting-reporter"
+	Operator         Role = "operator"
+	Admin            Role = "admin"
+)
+
+var (
+	ErrNoCredentials = errors.New("missing credentials")
+	ErrInvalidToken  = errors.New("invalid token")
+	ErrExpiredToken  = errors.New("token expired")
+	ErrUnknownRole   = errors.New("unknown role")
+)
+
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	switch r {
+	case Observer, SightingReporter, Operator, Admin:
+		return r, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownRole, s)
+}
+
+// Principal is the authenticated caller.
+type Principal struct {
+	Subject string `json:"subject"`
+	Role    Role   `json:"role"`
+	Team    string `json:"team,omitempty"`
+}
+
+// Allowed reports whether the principal holds one of roles. Admins are allowed everywhere.
+func (p Principal) Allowed(roles ...Role) bool {
+	return p.Role == Admin || slices.Contains(roles, p.Role)
+}
+
+type ctxKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator verifies static API keys and HS256 JWTs signed with a local secret.
+type Authenticator struct {
+	keys      map[string]Principal
+	jwtSecret []byte
+}
+
+func NewAuthenticator(jwtSecret string) *Authenticator {
+	return &Authenticator{
+		keys:      make(map[string]Principal),
+		jwtSecret: []byte(jwtSecret),
+	}
+}
+
+// AddKey registers a static API key for p.
+func (a *Authenticator) AddKey(key string, p Principal) {
+	a.keys[key] = p
+}
+
+// Enabled reports whether any credential source is configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0 || len(a.jwtSecret) > 0
+}
+
+// Authenticate reads the credential from the X-API-Key header or an
+// "Authorization: Bearer" header. When allowQuery is set, the access_token
+// query parameter is accepted too, for browser WebSocket and EventSource clients.
+func (a *Authenticator) Authenticate(r *http.Request, allowQuery bool) (Principal, error) {
+	token := r.Header.Get("X-API-Key")
+	if token == "" {
+		if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+			token = strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+		}
+	}
+	if token == "" && allowQuery {
+		token = r.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		return Principal{}, ErrNoCredentials
+	}
+	return a.Verify(token)
+}
+
+// Verify resolves a raw API key or JWT into a principal.
+func (a *Authenticator) Verify(token string) (Principal, error) {
+	for key, p := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return p, nil
+		}
+	}
+	if len(a.jwtSecret) > 0 && strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token)
+	}
+	return Principal{}, ErrInvalidToken
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	Role      string `json:"role"`
+	Team      string `json:"team"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+func (a *Authenticator) verifyJWT(token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return Principal{}, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return Principal{}, ErrInvalidToken
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	now := time.Now().Unix()
+	if claims.ExpiresAt != 0 && now >= claims.ExpiresAt {
+		return Principal{}, ErrExpiredToken
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return Principal{}, ErrInvalidToken
+	}
+
+	role, err := ParseRole(claims.Role)
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{Subject: claims.Subject, Role: role, Team: claims.Team}, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -1,5 +1,31 @@
 package broadcast
 
+import (
+	"fmt"
+	"time"
+)
+
 type Broadcaster interface {
 	Broadcast(msg string, messageType string, includeTime bool, options map[string]any)
 }
+
+// NewMessage builds the event body shared by every sink.
+// The "type" and "message" keys are reserved and cannot be overridden by options.
+func NewMessage(msg string, messageType string, includeTime bool, options map[string]any) (map[string]any, error) {
+	message := map[string]any{"type": messageType, "message": msg}
+
+	if includeTime {
+		message["time"] = time.Now().Format("2006-01-02 15:04:05.000")
+	}
+
+	for _, key := range []string{"type", "message"} {
+		if _, ok := options[key]; ok {
+			return nil, fmt.Errorf("broadcasting contains reserved key: %s", key)
+		}
+	}
+
+	for key, value := range options {
+		message[key] = value
+	}
+	return message, nil
+}
@@ -0,0 +1,97 @@
+package broadcast
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lines(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, event["message"].(string))
+	}
+	return out
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	// room for two events per file
+	line, _ := json.Marshal(map[string]any{"type": "n", "message": "0"})
+	f, err := NewFileSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 7 {
+		f.Broadcast(string(rune('0'+i)), "n", false, nil)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		path string
+		want string
+	}{
+		{path, "6"},
+		{path + ".1", "4,5"},
+		{path + ".2", "2,3"},
+	} {
+		if got := strings.Join(lines(t, tt.path), ","); got != tt.want {
+			t.Errorf("%s = %s, want %s", filepath.Base(tt.path), got, tt.want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("kept a third backup: %v", err)
+	}
+}
+
+func TestFileSinkWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	f, err := NewFileSink(path, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Broadcast("first", "n", false, nil)
+	f.Broadcast("second", "n", false, nil)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lines(t, path), ","); got != "second" {
+		t.Errorf("file = %s", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("kept a backup: %v", err)
+	}
+}
+
+func TestFileSinkAppendsAcrossReopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	for _, msg := range []string{"before", "after"} {
+		f, err := NewFileSink(path, 0, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Broadcast(msg, "n", true, map[string]any{"pokemon": "Mew"})
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := strings.Join(lines(t, path), ","); got != "before,after" {
+		t.Errorf("file = %s", got)
+	}
+}
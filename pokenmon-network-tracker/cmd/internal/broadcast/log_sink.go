@@ -0,0 +1,26 @@
+package broadcast
+
+import (
+	"io"
+	"log/slog"
+)
+
+// LogSink writes every event as a structured JSON log line.
+type LogSink struct {
+	logger *slog.Logger
+}
+
+func NewLogSink(w io.Writer) *LogSink {
+	return &LogSink{logger: slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+func (l *LogSink) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	attrs := []any{slog.String("type", messageType)}
+	for key, value := range options {
+		if key == "type" || key == "message" {
+			continue
+		}
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	l.logger.Info(msg, attrs...)
+}
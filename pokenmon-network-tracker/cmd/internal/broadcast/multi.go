@@ -0,0 +1,105 @@
+package broadcast
+
+import (
+	"log"
+	"sync"
+)
+
+const defaultSinkBuffer = 256
+
+// Multi fans every event out to a set of sinks.
+// Each sink runs behind its own buffered queue so a slow or failing sink
+// never blocks the caller or the other sinks. The event is built once, so
+// every sink records the time it happened rather than when the sink ran.
+type Multi struct {
+	mu    sync.RWMutex
+	sinks []*asyncSink
+}
+
+type asyncSink struct {
+	name  string
+	sink  Broadcaster
+	queue chan call
+}
+
+type call struct {
+	msg         string
+	messageType string
+	// fields is the built event without its reserved keys; sinks must not modify it
+	fields map[string]any
+}
+
+func NewMulti() *Multi {
+	return &Multi{}
+}
+
+// Add registers a sink under the given name with the default buffer size.
+func (m *Multi) Add(name string, sink Broadcaster) {
+	m.AddBuffered(name, sink, defaultSinkBuffer)
+}
+
+// AddBuffered registers a sink with a queue of size buf.
+// Events are dropped for that sink when its queue is full.
+func (m *Multi) AddBuffered(name string, sink Broadcaster, buf int) {
+	if buf <= 0 {
+		buf = defaultSinkBuffer
+	}
+	s := &asyncSink{
+		name:  name,
+		sink:  sink,
+		queue: make(chan call, buf),
+	}
+	go s.run()
+
+	m.mu.Lock()
+	m.sinks = append(m.sinks, s)
+	m.mu.Unlock()
+}
+
+// Sinks returns the names of the registered sinks.
+func (m *Multi) Sinks() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+func (m *Multi) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	message, err := NewMessage(msg, messageType, includeTime, options)
+	if err != nil {
+		log.Printf("error - %v", err)
+		return
+	}
+	delete(message, "type")
+	delete(message, "message")
+	c := call{msg: msg, messageType: messageType, fields: message}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, s := range m.sinks {
+		select {
+		case s.queue <- c:
+		default:
+			log.Printf("broadcast sink %s is full, dropping %q event", s.name, messageType)
+		}
+	}
+}
+
+func (s *asyncSink) run() {
+	for c := range s.queue {
+		s.deliver(c)
+	}
+}
+
+func (s *asyncSink) deliver(c call) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("broadcast sink %s panicked: %v", s.name, r)
+		}
+	}()
+	// the time, if any, is already among the fields
+	s.sink.Broadcast(c.msg, c.messageType, false, c.fields)
+}
@@ -0,0 +1,123 @@
+package broadcast
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder keeps the events it is given and signals each one on got.
+type recorder struct {
+	mu     sync.Mutex
+	events []map[string]any
+	got    chan struct{}
+	// block, when set, holds every delivery until it is closed
+	block chan struct{}
+}
+
+func newRecorder() *recorder {
+	return &recorder{got: make(chan struct{}, 16)}
+}
+
+func (r *recorder) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	message, err := NewMessage(msg, messageType, includeTime, options)
+	if err != nil {
+		panic(err)
+	}
+	r.mu.Lock()
+	r.events = append(r.events, message)
+	r.mu.Unlock()
+	r.got <- struct{}{}
+	if r.block != nil {
+		<-r.block
+	}
+}
+
+func (r *recorder) wait(t *testing.T, n int) []map[string]any {
+	t.Helper()
+	for range n {
+		select {
+		case <-r.got:
+		case <-time.After(time.Second):
+			t.Fatalf("waited for %d events", n)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.events
+}
+
+// panicker fails on every event.
+type panicker struct{}
+
+func (panicker) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	panic("sink failed")
+}
+
+func TestMultiSendsTheSameEventToEverySink(t *testing.T) {
+	m := NewMulti()
+	first, second := newRecorder(), newRecorder()
+	first.block = make(chan struct{})
+	m.Add("first", first)
+	m.Add("panicker", panicker{})
+	m.Add("second", second)
+	if got := m.Sinks(); len(got) != 3 || got[0] != "first" || got[2] != "second" {
+		t.Errorf("Sinks() = %v", got)
+	}
+
+	m.Broadcast("Pikachu captured", "pokemon capture", true, map[string]any{"pokemon": "Pikachu"})
+	m.Broadcast("Eevee captured", "pokemon capture", false, map[string]any{"pokemon": "Eevee"})
+	// the first sink runs late, yet records the time the event happened
+	time.Sleep(5 * time.Millisecond)
+	close(first.block)
+
+	a, b := first.wait(t, 2), second.wait(t, 2)
+	for i := range a {
+		if a[i]["time"] != b[i]["time"] || a[i]["pokemon"] != b[i]["pokemon"] || a[i]["type"] != "pokemon capture" {
+			t.Errorf("event %d: %v and %v", i, a[i], b[i])
+		}
+	}
+	if _, ok := a[0]["time"]; !ok {
+		t.Error("first event has no time")
+	}
+	if _, ok := a[1]["time"]; ok {
+		t.Error("second event has a time")
+	}
+}
+
+func TestMultiRejectsReservedKeys(t *testing.T) {
+	m := NewMulti()
+	r := newRecorder()
+	m.Add("recorder", r)
+	m.Broadcast("hello", "greeting", false, map[string]any{"type": "other"})
+	m.Broadcast("hello", "greeting", false, nil)
+	if events := r.wait(t, 1); len(events) != 1 || events[0]["type"] != "greeting" {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func TestMultiDropsEventsForAFullSink(t *testing.T) {
+	m := NewMulti()
+	slow, fast := newRecorder(), newRecorder()
+	slow.block = make(chan struct{})
+	m.AddBuffered("slow", slow, 1)
+	m.Add("fast", fast)
+
+	m.Broadcast("1", "n", false, nil)
+	slow.wait(t, 1)
+	// the slow sink holds the first event and queues the second
+	m.Broadcast("2", "n", false, nil)
+	m.Broadcast("3", "n", false, nil)
+	close(slow.block)
+
+	if events := fast.wait(t, 3); len(events) != 3 {
+		t.Errorf("fast sink got %d events, want 3", len(events))
+	}
+	slow.wait(t, 1)
+	time.Sleep(10 * time.Millisecond)
+	slow.mu.Lock()
+	defer slow.mu.Unlock()
+	if events := slow.events; len(events) != 2 || events[1]["message"] != "2" {
+		t.Errorf("slow sink got %v", events)
+	}
+}
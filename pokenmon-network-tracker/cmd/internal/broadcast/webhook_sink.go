@@ -0,0 +1,64 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookSink POSTs every event as JSON to a fixed URL. Only the host of the
+// URL is ever logged, as its path or query may carry a credential.
+type WebhookSink struct {
+	url    string
+	host   string
+	client *http.Client
+}
+
+func NewWebhookSink(rawURL string, timeout time.Duration) *WebhookSink {
+	host := "invalid URL"
+	if u, err := url.Parse(rawURL); err == nil {
+		host = u.Host
+	}
+	return &WebhookSink{
+		url:    rawURL,
+		host:   host,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Host is the host events are POSTed to.
+func (wh *WebhookSink) Host() string {
+	return wh.host
+}
+
+func (wh *WebhookSink) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	message, err := NewMessage(msg, messageType, includeTime, options)
+	if err != nil {
+		log.Printf("error - %v", err)
+		return
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("failed to marshal broadcast event: %v", err)
+		return
+	}
+
+	resp, err := wh.client.Post(wh.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the error names the whole URL, keep only its cause
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		log.Printf("webhook to %s failed: %v", wh.host, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("webhook to %s returned %s", wh.host, resp.Status)
+	}
+}
@@ -0,0 +1,58 @@
+package broadcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSinkPostsTheEvent(t *testing.T) {
+	got := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event map[string]any
+		json.NewDecoder(r.Body).Decode(&event)
+		got <- event
+	}))
+	defer srv.Close()
+
+	NewWebhookSink(srv.URL+"/events", time.Second).Broadcast("Mew captured", "pokemon capture", false, map[string]any{"pokemon": "Mew"})
+	event := <-got
+	if event["type"] != "pokemon capture" || event["message"] != "Mew captured" || event["pokemon"] != "Mew" {
+		t.Errorf("event = %v", event)
+	}
+}
+
+func TestWebhookSinkLogsOnlyTheHost(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	host := strings.TrimPrefix(srv.URL, "http://")
+	failing := NewWebhookSink(srv.URL+"/hooks/s3cret?token=t0ken", time.Second)
+	failing.Broadcast("hello", "greeting", false, nil)
+	srv.Close()
+	// the server is gone, so the POST itself fails
+	failing.Broadcast("hello", "greeting", false, nil)
+
+	if failing.Host() != host {
+		t.Errorf("Host() = %s, want %s", failing.Host(), host)
+	}
+	out := logs.String()
+	if !strings.Contains(out, "webhook to "+host+" returned 500") || !strings.Contains(out, "webhook to "+host+" failed") {
+		t.Errorf("logs = %s", out)
+	}
+	for _, secret := range []string{"s3cret", "t0ken", url.QueryEscape("t0ken")} {
+		if strings.Contains(out, secret) {
+			t.Errorf("logs show %q: %s", secret, out)
+		}
+	}
+}
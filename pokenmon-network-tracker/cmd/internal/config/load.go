@@ -0,0 +1,234 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration for the program called name from args
+// (without the program name). Settings are applied in order of precedence:
+// defaults, the YAML file given by -config or CONFIG_FILE, environment
+// variables, then flags. Every setting has a flag named after its YAML path,
+// e.g. -http.port or -broker.taskQueue. An environment variable or flag set
+// to "" clears a string or list setting, so ALERT_RULES= turns the alerts off;
+// other settings treat an empty variable as unset. The result is validated.
+func Load(name string, args []string) (Config, error) {
+	cfg := Default()
+	settings := fields(&cfg)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config `file` (env CONFIG_FILE)")
+
+	type override struct {
+		setting setting
+		raw     string
+	}
+	var overrides []override
+	for _, s := range settings {
+		usage := fmt.Sprintf("%s (env %s, default %s)", s.usage, s.env, s.display())
+		fs.Func(s.path, usage, func(raw string) error {
+			// parse now so mistakes are reported against the flag, apply after the file and env
+			if err := parse(reflect.New(s.value.Type()).Elem(), raw); err != nil {
+				return err
+			}
+			overrides = append(overrides, override{s, raw})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	if *path != "" {
+		if err := readFile(*path, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, s := range settings {
+		raw, ok := os.LookupEnv(s.env)
+		if !ok || raw == "" && !clearable(s.value) {
+			continue
+		}
+		if err := parse(s.value, raw); err != nil {
+			return cfg, fmt.Errorf("env %s: %w", s.env, err)
+		}
+	}
+
+	for _, o := range overrides {
+		if err := parse(o.setting.value, o.raw); err != nil {
+			return cfg, fmt.Errorf("flag -%s: %w", o.setting.path, err)
+		}
+	}
+
+	// an empty list set on purpose turns the alerts off
+	if cfg.Alerts.Rules == nil {
+		cfg.Alerts.Rules = DefaultAlertRules(cfg.Broker.TaskQueue)
+	}
+	return cfg, cfg.Validate()
+}
+
+func readFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted renders every setting as "path: value", one per line, with
+// secrets masked and passwords stripped from URLs. It is meant for boot logs.
+func (c *Config) Redacted() string {
+	var sb strings.Builder
+	for _, s := range fields(c) {
+		fmt.Fprintf(&sb, "  %s: %s\n", s.path, s.display())
+	}
+	return sb.String()
+}
+
+// setting is one leaf of Config with the metadata from its struct tags.
+type setting struct {
+	path   string
+	env    string
+	usage  string
+	secret string
+	value  reflect.Value
+}
+
+func fields(c *Config) []setting {
+	var out []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			path := prefix + f.Tag.Get("yaml")
+			if f.Type.Kind() == reflect.Struct && f.Type != durationType {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			out = append(out, setting{
+				path:   path,
+				env:    f.Tag.Get("env"),
+				usage:  f.Tag.Get("usage"),
+				secret: f.Tag.Get("secret"),
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "")
+	return out
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// parse sets v from its textual form. Lists are comma separated.
+func parse(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// clearable reports whether an empty value means something for v: an empty
+// string or an empty list, as opposed to a setting left unset.
+func clearable(v reflect.Value) bool {
+	return v.Kind() == reflect.String || v.Kind() == reflect.Slice
+}
+
+func (s setting) display() string {
+	var values []string
+	if s.value.Kind() == reflect.Slice {
+		values = slices.Clone(s.value.Interface().([]string))
+	} else if s.value.Type() == durationType {
+		values = []string{time.Duration(s.value.Int()).String()}
+	} else {
+		values = []string{fmt.Sprint(s.value.Interface())}
+	}
+
+	for i, v := range values {
+		switch {
+		case v == "":
+		case s.secret == "true":
+			values[i] = "[redacted]"
+		case s.secret == "url":
+			values[i] = redactURL(v)
+		}
+	}
+	if s.value.Kind() == reflect.Slice && len(values) == 0 {
+		return "[]"
+	}
+	if s.value.Kind() == reflect.String && values[0] == "" {
+		return `""`
+	}
+	return strings.Join(values, ",")
+}
+
+// redactURL drops the password and query string, either may carry a credential.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "[redacted]"
+	}
+	if u.RawQuery != "" {
+		u.RawQuery = "redacted"
+	}
+	return u.Redacted()
+}
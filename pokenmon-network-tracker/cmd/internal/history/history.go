@@ -0,0 +1,253 @@
+// Package history keeps a time series of tracker metrics in a fixed-size ring,
+// optionally mirrored to a JSON-lines file so it survives restarts.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MaxPoints bounds how many points a single query may return.
+const MaxPoints = 10000
+
+var (
+	ErrUnknownMetric = errors.New("unknown metric")
+	ErrInvalidRange  = errors.New("invalid range")
+)
+
+// Sample holds every metric's value at one instant.
+type Sample struct {
+	Time   time.Time          `json:"t"`
+	Values map[string]float64 `json:"v"`
+}
+
+// Point aggregates one metric's samples within a step. Gauges read best as
+// Avg, counts per sample as Sum.
+type Point struct {
+	Time    time.Time `json:"time"`
+	Avg     float64   `json:"avg"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+	Sum     float64   `json:"sum"`
+	Samples int       `json:"samples"`
+}
+
+// Store is safe for concurrent use.
+type Store struct {
+	mu      sync.RWMutex
+	samples []Sample
+	// next is where the following sample goes once the ring is full
+	next int
+
+	path    string
+	file    *os.File
+	written int
+}
+
+// NewStore keeps the latest capacity samples in memory only.
+func NewStore(capacity int) *Store {
+	return &Store{samples: make([]Sample, 0, max(capacity, 1))}
+}
+
+// Open keeps the latest capacity samples and mirrors them to the file at path,
+// loading what it already holds. The file is compacted once it grows to twice
+// the capacity.
+func Open(path string, capacity int) (*Store, error) {
+	s := NewStore(capacity)
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var sample Sample
+			// a torn last line from a crash is skipped
+			if json.Unmarshal(scanner.Bytes(), &sample) == nil {
+				s.add(sample)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("history file %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("history file: %w", err)
+	}
+
+	s.path = path
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) add(sample Sample) {
+	if len(s.samples) < cap(s.samples) {
+		s.samples = append(s.samples, sample)
+		return
+	}
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % len(s.samples)
+}
+
+// ordered returns the samples oldest first.
+func (s *Store) ordered() []Sample {
+	return append(slices.Clone(s.samples[s.next:]), s.samples[:s.next]...)
+}
+
+// compact writes the samples in memory to a temporary file, renames it over
+// the file and appends to it from then on. Until the rename succeeds the old
+// file and its handle stay as they were.
+func (s *Store) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("history file: %w", err)
+	}
+	fail := func(err error) error {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("history file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, sample := range s.ordered() {
+		if err := enc.Encode(sample); err != nil {
+			return fail(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fail(err)
+	}
+	if err := f.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fail(err)
+	}
+
+	// f now is the file at path
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = f
+	s.written = len(s.samples)
+	return nil
+}
+
+// Record adds a sample. Writing it to the file is best effort: when compacting
+// fails the sample is appended to the old file and compaction is tried again
+// with the next one.
+func (s *Store) Record(sample Sample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.add(sample)
+	if s.file == nil {
+		return nil
+	}
+
+	var compactErr error
+	if s.written >= 2*cap(s.samples) {
+		// a compacted file holds the new sample already
+		if compactErr = s.compact(); compactErr == nil {
+			return nil
+		}
+	}
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return errors.Join(compactErr, err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return errors.Join(compactErr, fmt.Errorf("history file: %w", err))
+	}
+	s.written++
+	return compactErr
+}
+
+// Latest returns the newest sample, false while the store is empty.
+func (s *Store) Latest() (Sample, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.samples) == 0 {
+		return Sample{}, false
+	}
+	return s.samples[(s.next+len(s.samples)-1)%len(s.samples)], true
+}
+
+// Metrics lists every metric the store holds samples of.
+func (s *Store) Metrics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	seen := make(map[string]bool)
+	for _, sample := range s.samples {
+		for name := range sample.Values {
+			seen[name] = true
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for name := range seen {
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Query aggregates metric over [from, to) in buckets of step, starting at from.
+// Buckets without samples are left out.
+func (s *Store) Query(metric string, from, to time.Time, step time.Duration) ([]Point, error) {
+	if step <= 0 {
+		return nil, fmt.Errorf("%w: step must be positive", ErrInvalidRange)
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidRange)
+	}
+	if to.Sub(from)/step > MaxPoints {
+		return nil, fmt.Errorf("%w: more than %d points, use a larger step", ErrInvalidRange, MaxPoints)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var points []Point
+	known := false
+	for _, sample := range s.ordered() {
+		v, ok := sample.Values[metric]
+		if !ok {
+			continue
+		}
+		known = true
+		if sample.Time.Before(from) || !sample.Time.Before(to) {
+			continue
+		}
+
+		start := from.Add(sample.Time.Sub(from) / step * step)
+		if n := len(points); n == 0 || !points[n-1].Time.Equal(start) {
+			points = append(points, Point{Time: start, Min: v, Max: v})
+		}
+		p := &points[len(points)-1]
+		p.Min, p.Max = min(p.Min, v), max(p.Max, v)
+		p.Sum += v
+		p.Samples++
+		p.Avg = p.Sum / float64(p.Samples)
+	}
+	if !known {
+		return nil, fmt.Errorf("%w %q", ErrUnknownMetric, metric)
+	}
+	if points == nil {
+		points = []Point{}
+	}
+	return points, nil
+}
+
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
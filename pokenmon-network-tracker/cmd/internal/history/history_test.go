@@ -0,0 +1,89 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sampleAt(i int) Sample {
+	return Sample{Time: time.Unix(int64(i), 0), Values: map[string]float64{"n": float64(i)}}
+}
+
+func values(t *testing.T, s *Store) []float64 {
+	t.Helper()
+	points, err := s.Query("n", time.Unix(0, 0), time.Unix(1000, 0), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]float64, len(points))
+	for i, p := range points {
+		out[i] = p.Avg
+	}
+	return out
+}
+
+func TestFileSurvivesAFailedCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	s, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if err := s.Record(sampleAt(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the temporary file cannot be created, so the fifth sample cannot compact
+	if err := os.Mkdir(path+".tmp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Record(sampleAt(5)); err == nil {
+		t.Error("compaction into a directory succeeded")
+	}
+	if err := os.Remove(path + ".tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Record(sampleAt(6)); err != nil {
+		t.Errorf("compaction after the directory left: %v", err)
+	}
+	if err := s.Record(sampleAt(7)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := values(t, reopened); len(got) != 2 || got[0] != 6 || got[1] != 7 {
+		t.Errorf("reopened store holds %v, want [6 7]", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+func TestOpenSkipsATornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	content := `{"t":"1970-01-01T00:00:01Z","v":{"n":1}}` + "\n" + `{"t":"1970-01-01T00:00:02Z","v":{"n":2}}` + "\n" + `{"t":"1970-01-01T00:0`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(path, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got := values(t, s); len(got) != 2 || got[1] != 2 {
+		t.Errorf("loaded %v, want [1 2]", got)
+	}
+	if latest, ok := s.Latest(); !ok || latest.Values["n"] != 2 {
+		t.Errorf("latest = %v, %v", latest, ok)
+	}
+}
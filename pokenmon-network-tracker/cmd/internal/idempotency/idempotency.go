@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMismatch is returned when a key is reused with a different request body.
+	ErrMismatch = errors.New("idempotency key reused with a different request body")
+	// ErrInFlight is returned when the first request for a key has not finished yet.
+	ErrInFlight = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Response is a stored response replayed for repeated keys.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	hash     string
+	response *Response
+	expires  time.Time
+}
+
+// Store remembers the first response for each key for a fixed window.
+type Store struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*entry
+}
+
+func NewStore(window time.Duration) *Store {
+	return &Store{
+		window:  window,
+		entries: make(map[string]*entry),
+	}
+}
+
+// Begin claims key for a request whose body hashes to hash. It returns the
+// stored response when the key was already completed with the same body,
+// ErrMismatch for a different body and ErrInFlight while the first request runs.
+// A nil response and nil error means the caller owns the key and must call
+// Complete or Release.
+func (s *Store) Begin(key, hash string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && time.Now().Before(e.expires) {
+		if e.hash != hash {
+			return nil, ErrMismatch
+		}
+		if e.response == nil {
+			return nil, ErrInFlight
+		}
+		return e.response, nil
+	}
+
+	s.entries[key] = &entry{hash: hash, expires: time.Now().Add(s.window)}
+	return nil, nil
+}
+
+// Complete stores the response for key.
+func (s *Store) Complete(key string, resp *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.response = resp
+	}
+}
+
+// Release forgets key so the request can be retried, e.g. after a server error.
+func (s *Store) Release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+}
+
+// Cleanup drops expired keys.
+func (s *Store) Cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, e := range s.entries {
+		if now.After(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
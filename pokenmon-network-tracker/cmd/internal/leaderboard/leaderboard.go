@@ -0,0 +1,409 @@
+// Package leaderboard scores agents on their capture outcomes and teams on the
+// sightings they report. Scores are counted by the hour for the last month and
+// in a running total, optionally kept in a JSON file across restarts.
+package leaderboard
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Windows a leaderboard can be read over. A day covers the current hour and
+// the 23 before it.
+const (
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+	All   = "all"
+)
+
+var Windows = []string{Day, Week, Month, All}
+
+var windowHours = map[string]int{Day: 24, Week: 7 * 24, Month: 30 * 24}
+
+// topN is how many entries a leaderboard update carries.
+const topN = 10
+
+var ErrUnknownWindow = errors.New("unknown window")
+
+type agentTally struct {
+	Name     string `json:"name"`
+	Captures int    `json:"captures"`
+	Failures int    `json:"failures"`
+	Rare     int    `json:"rare"`
+	// CaptureTime is the seconds spent on the attempts that captured
+	CaptureTime float64 `json:"captureTime"`
+}
+
+type teamTally struct {
+	Sightings  int `json:"sightings"`
+	Duplicates int `json:"duplicates"`
+	Captures   int `json:"captures"`
+	Escapes    int `json:"escapes"`
+}
+
+type bucket struct {
+	Start  time.Time             `json:"start,omitzero"`
+	Agents map[int]*agentTally   `json:"agents"`
+	Teams  map[string]*teamTally `json:"teams"`
+}
+
+func newBucket(start time.Time) *bucket {
+	return &bucket{Start: start, Agents: make(map[int]*agentTally), Teams: make(map[string]*teamTally)}
+}
+
+func (b *bucket) agent(id int, name string) *agentTally {
+	a, ok := b.Agents[id]
+	if !ok {
+		a = &agentTally{}
+		b.Agents[id] = a
+	}
+	if name != "" {
+		a.Name = name
+	}
+	return a
+}
+
+func (b *bucket) team(name string) *teamTally {
+	t, ok := b.Teams[name]
+	if !ok {
+		t = &teamTally{}
+		b.Teams[name] = t
+	}
+	return t
+}
+
+// AgentScore ranks agents by captures, then rare captures, then fewest failures.
+type AgentScore struct {
+	Rank         int    `json:"rank"`
+	Id           int    `json:"id"`
+	Name         string `json:"name"`
+	Captures     int    `json:"captures"`
+	Failures     int    `json:"failures"`
+	RareCaptures int    `json:"rareCaptures"`
+	// AverageTime is the seconds a capturing attempt took on average.
+	AverageTime float64 `json:"averageTime"`
+}
+
+// TeamScore ranks teams by sightings, then by how many of them were captured.
+// Duplicates are sightings merged into a task already dispatched.
+type TeamScore struct {
+	Rank       int    `json:"rank"`
+	Team       string `json:"team"`
+	Sightings  int    `json:"sightings"`
+	Duplicates int    `json:"duplicates"`
+	Captures   int    `json:"captures"`
+	Escapes    int    `json:"escapes"`
+}
+
+type Options struct {
+	// Rare names the pokemon whose captures count as rare, in any case.
+	Rare []string
+	// File keeps the scores across restarts when set.
+	File string
+}
+
+// Board is safe for concurrent use.
+type Board struct {
+	mu    sync.Mutex
+	rare  map[string]bool
+	total *bucket
+	// hours is ordered oldest first and reaches back a month
+	hours []*bucket
+	path  string
+	dirty bool
+
+	// the rankings last announced
+	agentOrder []int
+	teamOrder  []string
+}
+
+// Open loads the scores File holds, if any.
+func Open(opts Options) (*Board, error) {
+	b := &Board{rare: make(map[string]bool), total: newBucket(time.Time{}), path: opts.File}
+	for _, name := range opts.Rare {
+		b.rare[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	if b.path != "" {
+		data, err := os.ReadFile(b.path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("leaderboard file: %w", err)
+		default:
+			var saved struct {
+				Total *bucket   `json:"total"`
+				Hours []*bucket `json:"hours"`
+			}
+			if err := json.Unmarshal(data, &saved); err != nil {
+				return nil, fmt.Errorf("leaderboard file %s: %w", b.path, err)
+			}
+			if saved.Total != nil {
+				b.total = saved.Total
+			}
+			b.hours = saved.Hours
+		}
+	}
+	b.agentOrder, b.teamOrder = agentOrder(b.agents(b.total)), teamOrder(b.teams(b.total))
+	return b, nil
+}
+
+// hour returns the bucket at falls in, dropping those older than a month.
+func (b *Board) hour(at time.Time) *bucket {
+	start := at.Truncate(time.Hour)
+	i, found := slices.BinarySearchFunc(b.hours, start, func(h *bucket, start time.Time) int {
+		return h.Start.Compare(start)
+	})
+	if !found {
+		b.hours = slices.Insert(b.hours, i, newBucket(start))
+	}
+	h := b.hours[i]
+	cutoff := b.hours[len(b.hours)-1].Start.Add(-time.Duration(windowHours[Month]) * time.Hour)
+	for len(b.hours) > 0 && !b.hours[0].Start.After(cutoff) {
+		b.hours = b.hours[1:]
+	}
+	b.dirty = true
+	return h
+}
+
+// Capture credits an agent's capture of pokemon and the teams that reported it.
+func (b *Board) Capture(at time.Time, agentId int, agent, pokemon string, took time.Duration, reporters []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rare := b.rare[strings.ToLower(pokemon)]
+	for _, bk := range []*bucket{b.total, b.hour(at)} {
+		a := bk.agent(agentId, agent)
+		a.Captures++
+		a.CaptureTime += took.Seconds()
+		if rare {
+			a.Rare++
+		}
+		for _, team := range reporters {
+			bk.team(team).Captures++
+		}
+	}
+}
+
+// Failure counts an agent's failed capture attempt.
+func (b *Board) Failure(at time.Time, agentId int, agent string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, bk := range []*bucket{b.total, b.hour(at)} {
+		bk.agent(agentId, agent).Failures++
+	}
+}
+
+// Sighting credits a team's sighting; duplicates were merged into a task already dispatched.
+func (b *Board) Sighting(at time.Time, team string, duplicate bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, bk := range []*bucket{b.total, b.hour(at)} {
+		t := bk.team(team)
+		t.Sightings++
+		if duplicate {
+			t.Duplicates++
+		}
+	}
+}
+
+// Escape counts a task that expired against the teams that reported it.
+func (b *Board) Escape(at time.Time, reporters []string) {
+	if len(reporters) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, bk := range []*bucket{b.total, b.hour(at)} {
+		for _, team := range reporters {
+			bk.team(team).Escapes++
+		}
+	}
+}
+
+// window sums the buckets window covers.
+func (b *Board) window(window string, now time.Time) (*bucket, error) {
+	if window == All {
+		return b.total, nil
+	}
+	if _, ok := windowHours[window]; !ok {
+		return nil, fmt.Errorf("%w %q, want one of %s", ErrUnknownWindow, window, strings.Join(Windows, ", "))
+	}
+	from := From(window, now)
+	sum := newBucket(from)
+	for _, h := range b.hours {
+		if h.Start.Before(from) {
+			continue
+		}
+		for id, a := range h.Agents {
+			s := sum.agent(id, a.Name)
+			s.Captures += a.Captures
+			s.Failures += a.Failures
+			s.Rare += a.Rare
+			s.CaptureTime += a.CaptureTime
+		}
+		for name, t := range h.Teams {
+			s := sum.team(name)
+			s.Sightings += t.Sightings
+			s.Duplicates += t.Duplicates
+			s.Captures += t.Captures
+			s.Escapes += t.Escapes
+		}
+	}
+	return sum, nil
+}
+
+// From is where window starts, zero for All.
+func From(window string, now time.Time) time.Time {
+	hours, ok := windowHours[window]
+	if !ok {
+		return time.Time{}
+	}
+	return now.Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour)
+}
+
+// Agents ranks the agents over window.
+func (b *Board) Agents(window string) ([]AgentScore, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sum, err := b.window(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return b.agents(sum), nil
+}
+
+// Teams ranks the teams over window.
+func (b *Board) Teams(window string) ([]TeamScore, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sum, err := b.window(window, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return b.teams(sum), nil
+}
+
+func (b *Board) agents(bk *bucket) []AgentScore {
+	out := make([]AgentScore, 0, len(bk.Agents))
+	for id, a := range bk.Agents {
+		s := AgentScore{Id: id, Name: a.Name, Captures: a.Captures, Failures: a.Failures, RareCaptures: a.Rare}
+		if a.Captures > 0 {
+			s.AverageTime = a.CaptureTime / float64(a.Captures)
+		}
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(x, y AgentScore) int {
+		return cmp.Or(
+			cmp.Compare(y.Captures, x.Captures),
+			cmp.Compare(y.RareCaptures, x.RareCaptures),
+			cmp.Compare(x.Failures, y.Failures),
+			cmp.Compare(x.Id, y.Id),
+		)
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+func (b *Board) teams(bk *bucket) []TeamScore {
+	out := make([]TeamScore, 0, len(bk.Teams))
+	for name, t := range bk.Teams {
+		out = append(out, TeamScore{Team: name, Sightings: t.Sightings, Duplicates: t.Duplicates, Captures: t.Captures, Escapes: t.Escapes})
+	}
+	slices.SortFunc(out, func(x, y TeamScore) int {
+		return cmp.Or(
+			cmp.Compare(y.Sightings, x.Sightings),
+			cmp.Compare(y.Captures, x.Captures),
+			cmp.Compare(x.Team, y.Team),
+		)
+	})
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	return out
+}
+
+func agentOrder(scores []AgentScore) []int {
+	out := make([]int, len(scores))
+	for i, s := range scores {
+		out[i] = s.Id
+	}
+	return out
+}
+
+func teamOrder(scores []TeamScore) []string {
+	out := make([]string, len(scores))
+	for i, s := range scores {
+		out[i] = s.Team
+	}
+	return out
+}
+
+// MaxAgentId is the highest agent id scored, -1 before any.
+func (b *Board) MaxAgentId() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := -1
+	for a := range b.total.Agents {
+		id = max(id, a)
+	}
+	return id
+}
+
+// Announce broadcasts a "leaderboard update" with the top of the all-time
+// rankings when the order of the agents or the teams changed since the last call.
+func (b *Board) Announce(bc broadcast.Broadcaster) {
+	b.mu.Lock()
+	agents, teams := b.agents(b.total), b.teams(b.total)
+	agentsMoved, teamsMoved := !slices.Equal(agentOrder(agents), b.agentOrder), !slices.Equal(teamOrder(teams), b.teamOrder)
+	b.agentOrder, b.teamOrder = agentOrder(agents), teamOrder(teams)
+	b.mu.Unlock()
+	if !agentsMoved && !teamsMoved {
+		return
+	}
+
+	msg := "Leaderboard updated"
+	if len(agents) > 0 {
+		msg += fmt.Sprintf(", top agent %s with %d captures", agents[0].Name, agents[0].Captures)
+	}
+	if len(teams) > 0 {
+		msg += fmt.Sprintf(", top team %s with %d sightings", teams[0].Team, teams[0].Sightings)
+	}
+	bc.Broadcast(msg, "leaderboard update", true, map[string]any{
+		"agentsChanged": agentsMoved,
+		"teamsChanged":  teamsMoved,
+		"agents":        agents[:min(len(agents), topN)],
+		"teams":         teams[:min(len(teams), topN)],
+	})
+}
+
+// Save writes the scores to the file when they changed since the last save.
+func (b *Board) Save() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.path == "" || !b.dirty {
+		return nil
+	}
+	data, err := json.Marshal(map[string]any{"total": b.total, "hours": b.hours})
+	if err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("leaderboard file: %w", err)
+	}
+	if err := os.Rename(tmp, b.path); err != nil {
+		return fmt.Errorf("leaderboard file: %w", err)
+	}
+	b.dirty = false
+	return nil
+}
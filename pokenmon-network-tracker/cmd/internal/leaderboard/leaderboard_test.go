@@ -0,0 +1,181 @@
+package leaderboard
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recorder keeps the options of every broadcast.
+type recorder struct{ updates []map[string]any }
+
+func (r *recorder) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	r.updates = append(r.updates, options)
+}
+
+func open(t *testing.T, opts Options) *Board {
+	t.Helper()
+	b, err := Open(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func starts(b *Board) []time.Time {
+	out := make([]time.Time, len(b.hours))
+	for i, h := range b.hours {
+		out[i] = h.Start
+	}
+	return out
+}
+
+func TestHourBuckets(t *testing.T) {
+	b := open(t, Options{})
+	now := time.Date(2024, 5, 31, 12, 30, 0, 0, time.UTC)
+	hour := now.Truncate(time.Hour)
+
+	b.Failure(now, 1, "Jessie")
+	b.Failure(now.Add(10*time.Minute), 1, "Jessie")
+	// late events land in their own hour, in order
+	b.Failure(now.Add(-2*time.Hour), 1, "Jessie")
+	want := []time.Time{hour.Add(-2 * time.Hour), hour}
+	if got := starts(b); !slices.Equal(got, want) {
+		t.Fatalf("hours = %v, want %v", got, want)
+	}
+	if b.hours[1].Agents[1].Failures != 2 {
+		t.Errorf("failures in the current hour = %d, want 2", b.hours[1].Agents[1].Failures)
+	}
+
+	// a month on, the old hours are dropped but still count in the total
+	later := now.Add(time.Duration(windowHours[Month]) * time.Hour)
+	b.Failure(later, 1, "Jessie")
+	if got := starts(b); !slices.Equal(got, []time.Time{later.Truncate(time.Hour)}) {
+		t.Errorf("hours = %v", got)
+	}
+	// too old for any window: counted in the total only
+	b.Failure(now.Add(-time.Hour), 1, "Jessie")
+	if len(b.hours) != 1 {
+		t.Errorf("hours = %v", starts(b))
+	}
+	if b.total.Agents[1].Failures != 5 {
+		t.Errorf("total failures = %d, want 5", b.total.Agents[1].Failures)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	b := open(t, Options{})
+	now := time.Now()
+	b.Sighting(now, "red", false)
+	b.Sighting(now.Add(-30*time.Hour), "red", true)
+	b.Sighting(now.Add(-10*24*time.Hour), "blue", false)
+
+	for _, tt := range []struct {
+		window string
+		want   []TeamScore
+	}{
+		{Day, []TeamScore{{Rank: 1, Team: "red", Sightings: 1}}},
+		{Week, []TeamScore{{Rank: 1, Team: "red", Sightings: 2, Duplicates: 1}}},
+		{Month, []TeamScore{{Rank: 1, Team: "red", Sightings: 2, Duplicates: 1}, {Rank: 2, Team: "blue", Sightings: 1}}},
+	} {
+		got, err := b.Teams(tt.window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s = %+v, want %+v", tt.window, got, tt.want)
+		}
+	}
+	if _, err := b.Teams("year"); err == nil {
+		t.Error("unknown window accepted")
+	}
+}
+
+func TestAgentRanking(t *testing.T) {
+	b := open(t, Options{Rare: []string{" Mew "}})
+	now := time.Now()
+	// Cassidy and Jessie tie on captures; Jessie's capture is rare
+	b.Capture(now, 3, "Cassidy", "Pidgey", 4*time.Second, nil)
+	b.Capture(now, 1, "Jessie", "mew", 2*time.Second, nil)
+	// James and Butch tie on everything but failures
+	b.Failure(now, 2, "James")
+	b.Failure(now, 2, "James")
+	b.Failure(now, 4, "Butch")
+
+	got, err := b.Agents(All)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []AgentScore{
+		{Rank: 1, Id: 1, Name: "Jessie", Captures: 1, RareCaptures: 1, AverageTime: 2},
+		{Rank: 2, Id: 3, Name: "Cassidy", Captures: 1, AverageTime: 4},
+		{Rank: 3, Id: 4, Name: "Butch", Failures: 1},
+		{Rank: 4, Id: 2, Name: "James", Failures: 2},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("agents = %+v, want %+v", got, want)
+	}
+}
+
+func TestAnnounceOnlyWhenTheOrderChanges(t *testing.T) {
+	b := open(t, Options{})
+	r := &recorder{}
+	now := time.Now()
+
+	b.Announce(r)
+	if len(r.updates) != 0 {
+		t.Fatalf("announced an empty board: %v", r.updates)
+	}
+
+	b.Capture(now, 1, "Jessie", "Pidgey", time.Second, []string{"red"})
+	b.Capture(now, 2, "James", "Pidgey", time.Second, nil)
+	b.Announce(r)
+	if len(r.updates) != 1 || r.updates[0]["agentsChanged"] != true || r.updates[0]["teamsChanged"] != true {
+		t.Fatalf("updates = %v", r.updates)
+	}
+
+	// more points without a new order is not news
+	b.Capture(now, 1, "Jessie", "Pidgey", time.Second, nil)
+	b.Announce(r)
+	if len(r.updates) != 1 {
+		t.Fatalf("announced an unchanged order: %v", r.updates[1:])
+	}
+
+	// b overtakes a
+	b.Capture(now, 2, "James", "Pidgey", time.Second, nil)
+	b.Capture(now, 2, "James", "Pidgey", time.Second, nil)
+	b.Announce(r)
+	if len(r.updates) != 2 || r.updates[1]["agentsChanged"] != true || r.updates[1]["teamsChanged"] != false {
+		t.Fatalf("updates = %v", r.updates)
+	}
+	if top := r.updates[1]["agents"].([]AgentScore)[0]; top.Id != 2 || top.Captures != 3 {
+		t.Errorf("top agent = %+v", top)
+	}
+}
+
+func TestSaveAndOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leaderboard.json")
+	b := open(t, Options{File: path})
+	b.Capture(time.Now(), 1, "Jessie", "Pidgey", time.Second, []string{"red"})
+	if err := b.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := open(t, Options{File: path})
+	for _, window := range Windows {
+		got, err := reopened.Agents(window)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0].Id != 1 || got[0].Captures != 1 {
+			t.Errorf("%s = %+v", window, got)
+		}
+	}
+	// the order was restored with the scores, so there is nothing to announce
+	r := &recorder{}
+	reopened.Announce(r)
+	if len(r.updates) != 0 {
+		t.Errorf("updates = %v", r.updates)
+	}
+}
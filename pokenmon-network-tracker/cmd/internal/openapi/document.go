@@ -0,0 +1,256 @@
+// Package openapi loads the subset of an OpenAPI 3.0 document the tracker
+// uses and validates requests and responses against it.
+package openapi
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Schema struct {
+	Ref                  string             `yaml:"$ref"`
+	Type                 string             `yaml:"type"`
+	Format               string             `yaml:"format"`
+	Enum                 []any              `yaml:"enum"`
+	Minimum              *float64           `yaml:"minimum"`
+	Maximum              *float64           `yaml:"maximum"`
+	MinLength            *int               `yaml:"minLength"`
+	MaxLength            *int               `yaml:"maxLength"`
+	MinItems             *int               `yaml:"minItems"`
+	MaxItems             *int               `yaml:"maxItems"`
+	Items                *Schema            `yaml:"items"`
+	Properties           map[string]*Schema `yaml:"properties"`
+	Required             []string           `yaml:"required"`
+	AdditionalProperties yaml.Node          `yaml:"additionalProperties"`
+	Nullable             bool               `yaml:"nullable"`
+	ReadOnly             bool               `yaml:"readOnly"`
+	WriteOnly            bool               `yaml:"writeOnly"`
+
+	// additional is AdditionalProperties when it holds a schema;
+	// closed is set when it is false.
+	additional *Schema
+	closed     bool
+}
+
+type Parameter struct {
+	Ref      string  `yaml:"$ref"`
+	Name     string  `yaml:"name"`
+	In       string  `yaml:"in"`
+	Required bool    `yaml:"required"`
+	Schema   *Schema `yaml:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `yaml:"schema"`
+}
+
+type RequestBody struct {
+	Ref      string               `yaml:"$ref"`
+	Required bool                 `yaml:"required"`
+	Content  map[string]MediaType `yaml:"content"`
+}
+
+type Response struct {
+	Ref         string               `yaml:"$ref"`
+	Description string               `yaml:"description"`
+	Content     map[string]MediaType `yaml:"content"`
+}
+
+type Operation struct {
+	Parameters  []*Parameter         `yaml:"parameters"`
+	RequestBody *RequestBody         `yaml:"requestBody"`
+	Responses   map[string]*Response `yaml:"responses"`
+	Deprecated  bool                 `yaml:"deprecated"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `yaml:"parameters"`
+	Get        *Operation   `yaml:"get"`
+	Put        *Operation   `yaml:"put"`
+	Post       *Operation   `yaml:"post"`
+	Delete     *Operation   `yaml:"delete"`
+	Patch      *Operation   `yaml:"patch"`
+}
+
+func (p *PathItem) operations() map[string]*Operation {
+	ops := map[string]*Operation{}
+	for method, op := range map[string]*Operation{
+		http.MethodGet: p.Get, http.MethodPut: p.Put, http.MethodPost: p.Post,
+		http.MethodDelete: p.Delete, http.MethodPatch: p.Patch,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+type Components struct {
+	Schemas       map[string]*Schema      `yaml:"schemas"`
+	Parameters    map[string]*Parameter   `yaml:"parameters"`
+	RequestBodies map[string]*RequestBody `yaml:"requestBodies"`
+	Responses     map[string]*Response    `yaml:"responses"`
+}
+
+type Document struct {
+	Paths      map[string]*PathItem `yaml:"paths"`
+	Components Components           `yaml:"components"`
+
+	routes []route
+}
+
+// Load parses an OpenAPI document and resolves its local $refs.
+// A $ref that points nowhere is an error.
+func Load(data []byte) (*Document, error) {
+	var d Document
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("openapi: %w", err)
+	}
+	r := resolver{doc: &d, seen: map[*Schema]bool{}}
+	for name, s := range d.Components.Schemas {
+		d.Components.Schemas[name] = r.schema(s)
+	}
+	for template, item := range d.Paths {
+		for i, p := range item.Parameters {
+			item.Parameters[i] = r.parameter(p)
+		}
+		for method, op := range item.operations() {
+			for i, p := range op.Parameters {
+				op.Parameters[i] = r.parameter(p)
+			}
+			op.Parameters = mergeParameters(item.Parameters, op.Parameters)
+			if op.RequestBody != nil {
+				op.RequestBody = r.requestBody(op.RequestBody)
+			}
+			for code, resp := range op.Responses {
+				op.Responses[code] = r.response(resp)
+			}
+			d.routes = append(d.routes, newRoute(method, template, op))
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	sort.Slice(d.routes, func(i, j int) bool { return d.routes[i].template < d.routes[j].template })
+	return &d, nil
+}
+
+// mergeParameters lets an operation's parameters override the path item's by name and location.
+func mergeParameters(shared, own []*Parameter) []*Parameter {
+	out := append([]*Parameter(nil), own...)
+	for _, p := range shared {
+		overridden := false
+		for _, o := range own {
+			if o.Name == p.Name && o.In == p.In {
+				overridden = true
+			}
+		}
+		if !overridden {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+type resolver struct {
+	doc  *Document
+	seen map[*Schema]bool
+	err  error
+}
+
+func (r *resolver) fail(ref string) {
+	if r.err == nil {
+		r.err = fmt.Errorf("openapi: unresolved $ref %q", ref)
+	}
+}
+
+func refName(ref, section string) (string, bool) {
+	return strings.CutPrefix(ref, "#/components/"+section+"/")
+}
+
+func (r *resolver) schema(s *Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		name, ok := refName(s.Ref, "schemas")
+		target := r.doc.Components.Schemas[name]
+		if !ok || target == nil {
+			r.fail(s.Ref)
+			return s
+		}
+		return r.schema(target)
+	}
+	if r.seen[s] {
+		return s
+	}
+	r.seen[s] = true
+
+	s.Items = r.schema(s.Items)
+	for name, p := range s.Properties {
+		s.Properties[name] = r.schema(p)
+	}
+	switch s.AdditionalProperties.Kind {
+	case yaml.ScalarNode:
+		s.closed = s.AdditionalProperties.Value == "false"
+	case yaml.MappingNode:
+		var extra Schema
+		if err := s.AdditionalProperties.Decode(&extra); err != nil && r.err == nil {
+			r.err = fmt.Errorf("openapi: additionalProperties: %w", err)
+		}
+		s.additional = r.schema(&extra)
+	}
+	return s
+}
+
+func (r *resolver) parameter(p *Parameter) *Parameter {
+	if p.Ref != "" {
+		name, ok := refName(p.Ref, "parameters")
+		target := r.doc.Components.Parameters[name]
+		if !ok || target == nil {
+			r.fail(p.Ref)
+			return p
+		}
+		p = target
+	}
+	p.Schema = r.schema(p.Schema)
+	return p
+}
+
+func (r *resolver) requestBody(b *RequestBody) *RequestBody {
+	if b.Ref != "" {
+		name, ok := refName(b.Ref, "requestBodies")
+		target := r.doc.Components.RequestBodies[name]
+		if !ok || target == nil {
+			r.fail(b.Ref)
+			return b
+		}
+		b = target
+	}
+	for ct, mt := range b.Content {
+		mt.Schema = r.schema(mt.Schema)
+		b.Content[ct] = mt
+	}
+	return b
+}
+
+func (r *resolver) response(resp *Response) *Response {
+	if resp.Ref != "" {
+		name, ok := refName(resp.Ref, "responses")
+		target := r.doc.Components.Responses[name]
+		if !ok || target == nil {
+			r.fail(resp.Ref)
+			return resp
+		}
+		resp = target
+	}
+	for ct, mt := range resp.Content {
+		mt.Schema = r.schema(mt.Schema)
+		resp.Content[ct] = mt
+	}
+	return resp
+}
@@ -0,0 +1,86 @@
+package openapi
+
+import "strings"
+
+type route struct {
+	method   string
+	template string
+	segments []string
+	op       *Operation
+}
+
+func newRoute(method, template string, op *Operation) route {
+	return route{
+		method:   method,
+		template: template,
+		segments: strings.Split(strings.Trim(template, "/"), "/"),
+		op:       op,
+	}
+}
+
+// match reports whether path fits the template, the number of literal
+// segments it matched, and the values of its path parameters.
+func (rt route) match(path string) (bool, int, map[string]string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != len(rt.segments) {
+		return false, 0, nil
+	}
+	literal := 0
+	params := map[string]string{}
+	for i, seg := range rt.segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			if parts[i] == "" {
+				return false, 0, nil
+			}
+			params[seg[1:len(seg)-1]] = parts[i]
+			continue
+		}
+		if seg != parts[i] {
+			return false, 0, nil
+		}
+		literal++
+	}
+	return true, literal, params
+}
+
+// Find returns the operation documented for method and path along with its
+// path parameters. Literal segments win over templated ones.
+func (d *Document) Find(method, path string) (*Operation, map[string]string, bool) {
+	var best *route
+	var bestParams map[string]string
+	bestLiteral := -1
+	for i := range d.routes {
+		rt := &d.routes[i]
+		if rt.method != method {
+			continue
+		}
+		ok, literal, params := rt.match(path)
+		if ok && literal > bestLiteral {
+			best, bestParams, bestLiteral = rt, params, literal
+		}
+	}
+	if best == nil {
+		return nil, nil, false
+	}
+	return best.op, bestParams, true
+}
+
+// Has reports whether the document describes method on the given path
+// template, e.g. "/webhooks/{id}".
+func (d *Document) Has(method, template string) bool {
+	for _, rt := range d.routes {
+		if rt.method == method && rt.template == template {
+			return true
+		}
+	}
+	return false
+}
+
+// Operations lists every documented operation as "METHOD /template".
+func (d *Document) Operations() []string {
+	ops := make([]string, 0, len(d.routes))
+	for _, rt := range d.routes {
+		ops = append(ops, rt.method+" "+rt.template)
+	}
+	return ops
+}
@@ -0,0 +1,302 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldError names the part of a request or response that broke the schema.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (f FieldError) String() string {
+	if f.Field == "" {
+		return f.Message
+	}
+	return f.Field + ": " + f.Message
+}
+
+// Direction tells the validator whether readOnly or writeOnly properties may be left out.
+type Direction int
+
+const (
+	InRequest Direction = iota
+	InResponse
+)
+
+// ValidateParameters checks the path, query and header parameters of r.
+func (op *Operation) ValidateParameters(r *http.Request, pathParams map[string]string) []FieldError {
+	var errs []FieldError
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var value string
+		var present bool
+		switch p.In {
+		case "path":
+			value, present = pathParams[p.Name]
+		case "query":
+			present = query.Has(p.Name)
+			value = query.Get(p.Name)
+		case "header":
+			value = r.Header.Get(p.Name)
+			present = value != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				errs = append(errs, FieldError{p.Name, "is required"})
+			}
+			continue
+		}
+		if p.Schema == nil {
+			continue
+		}
+		v, err := coerce(p.Schema.Type, value)
+		if err != nil {
+			errs = append(errs, FieldError{p.Name, err.Error()})
+			continue
+		}
+		errs = append(errs, validate(p.Schema, v, p.Name, InRequest)...)
+	}
+	return errs
+}
+
+// coerce turns a raw parameter into the JSON value its schema type expects.
+func coerce(typ, value string) (any, error) {
+	switch typ {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return json.Number(value), nil
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("must be a number")
+		}
+		return json.Number(value), nil
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// RequestBodyType returns the documented media type matching contentType.
+// An empty contentType matches when the body has a single media type.
+func (op *Operation) RequestBodyType(contentType string) (string, MediaType, bool) {
+	if op.RequestBody == nil {
+		return "", MediaType{}, false
+	}
+	if contentType == "" && len(op.RequestBody.Content) == 1 {
+		for ct, mt := range op.RequestBody.Content {
+			return ct, mt, true
+		}
+	}
+	return lookupMediaType(op.RequestBody.Content, contentType)
+}
+
+// RequestBodyTypes lists the media types the operation accepts.
+func (op *Operation) RequestBodyTypes() []string {
+	if op.RequestBody == nil {
+		return nil
+	}
+	var types []string
+	for ct := range op.RequestBody.Content {
+		types = append(types, ct)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ResponseType returns the documented response for status and the media type
+// matching contentType. declared is false when the status is not documented;
+// the default response only covers errors.
+func (op *Operation) ResponseType(status int, contentType string) (mt MediaType, hasSchema bool, declared bool) {
+	code := strconv.Itoa(status)
+	resp, ok := op.Responses[code]
+	if !ok {
+		resp, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok && status >= 400 {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return MediaType{}, false, false
+	}
+	_, mt, found := lookupMediaType(resp.Content, contentType)
+	return mt, found && mt.Schema != nil, true
+}
+
+func lookupMediaType(content map[string]MediaType, contentType string) (string, MediaType, bool) {
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", MediaType{}, false
+	}
+	for ct, mt := range content {
+		if strings.EqualFold(ct, media) {
+			return ct, mt, true
+		}
+	}
+	return "", MediaType{}, false
+}
+
+// ValidateJSON checks a JSON document against s.
+func ValidateJSON(s *Schema, data []byte, dir Direction) []FieldError {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []FieldError{{"", "body must be valid JSON"}}
+	}
+	if dec.More() {
+		return []FieldError{{"", "body must have only a single JSON value"}}
+	}
+	return validate(s, v, "", dir)
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func validate(s *Schema, v any, path string, dir Direction) []FieldError {
+	if s == nil {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable {
+			return nil
+		}
+		return []FieldError{{path, "must not be null"}}
+	}
+
+	var errs []FieldError
+	fail := func(format string, args ...any) {
+		errs = append(errs, FieldError{path, fmt.Sprintf(format, args...)})
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("must be an object")
+			return errs
+		}
+		for _, name := range s.Required {
+			prop := s.Properties[name]
+			if prop != nil && ((dir == InRequest && prop.ReadOnly) || (dir == InResponse && prop.WriteOnly)) {
+				continue
+			}
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, FieldError{join(path, name), "is required"})
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				errs = append(errs, validate(prop, obj[name], join(path, name), dir)...)
+			} else if s.additional != nil {
+				errs = append(errs, validate(s.additional, obj[name], join(path, name), dir)...)
+			} else if s.closed {
+				errs = append(errs, FieldError{join(path, name), "is not allowed"})
+			}
+		}
+		return errs
+
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			fail("must be an array")
+			return errs
+		}
+		if s.MinItems != nil && len(arr) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(arr) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		for i, item := range arr {
+			errs = append(errs, validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i), dir)...)
+		}
+		return errs
+
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("must be a string")
+			return errs
+		}
+		n := len([]rune(str))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+
+	case "integer", "number":
+		kind := "a number"
+		if s.Type == "integer" {
+			kind = "an integer"
+		}
+		num, ok := v.(json.Number)
+		if !ok {
+			fail("must be %s", kind)
+			return errs
+		}
+		f, err := num.Float64()
+		if err != nil || (s.Type == "integer" && f != math.Trunc(f)) {
+			fail("must be %s", kind)
+			return errs
+		}
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be at least %v", *s.Minimum)
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be at most %v", *s.Maximum)
+		}
+
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("must be a boolean")
+			return errs
+		}
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprint(e)
+		}
+		fail("must be one of %s", strings.Join(allowed, ", "))
+	}
+	return errs
+}
+
+func inEnum(enum []any, v any) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
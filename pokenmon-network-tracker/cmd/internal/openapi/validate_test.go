@@ -0,0 +1,168 @@
+package openapi
+
+import (
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+const testSpec = `
+openapi: 3.0.3
+info: {title: test, version: "1"}
+paths:
+  /teams/{name}:
+    parameters:
+      - name: name
+        in: path
+        required: true
+        schema: {type: string, maxLength: 8}
+    put:
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer, minimum: 1, maximum: 100}
+        - name: X-Trace
+          in: header
+          required: true
+          schema: {type: string}
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/team'}
+      responses:
+        '200':
+          description: ok
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/team'}
+components:
+  schemas:
+    team:
+      type: object
+      additionalProperties: false
+      required: [id, elements, active]
+      properties:
+        id: {type: integer, readOnly: true}
+        secret: {type: string, writeOnly: true}
+        elements:
+          type: array
+          minItems: 1
+          maxItems: 2
+          items: {type: string, enum: [fire, water]}
+        active: {type: boolean}
+        score: {type: number, minimum: 0, nullable: true}
+        motto: {type: string, minLength: 2}
+        tags:
+          type: object
+          additionalProperties: {type: integer}
+`
+
+func loadTestSpec(t *testing.T) *Operation {
+	t.Helper()
+	doc, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, _, ok := doc.Find("PUT", "/teams/red")
+	if !ok {
+		t.Fatal("PUT /teams/{name} not found")
+	}
+	return op
+}
+
+func fields(errs []FieldError) []string {
+	out := make([]string, len(errs))
+	for i, e := range errs {
+		out[i] = e.String()
+	}
+	return out
+}
+
+func TestValidateJSON(t *testing.T) {
+	op := loadTestSpec(t)
+	_, mt, ok := op.RequestBodyType("application/json; charset=utf-8")
+	if !ok {
+		t.Fatal("no JSON request body")
+	}
+
+	for _, tc := range []struct {
+		name string
+		body string
+		dir  Direction
+		want []string
+	}{
+		{"valid request", `{"elements":["fire"],"active":true}`, InRequest, nil},
+		{"read-only id may be left out of a request", `{"elements":["fire","water"],"active":false,"score":1.5}`, InRequest, nil},
+		{"read-only id is required in a response", `{"elements":["fire"],"active":true}`, InResponse, []string{"id: is required"}},
+		{"write-only secret may be left out of a response", `{"id":1,"elements":["fire"],"active":true}`, InResponse, nil},
+		{"nullable score", `{"elements":["fire"],"active":true,"score":null}`, InRequest, nil},
+		{"additional properties schema", `{"elements":["fire"],"active":true,"tags":{"a":1,"b":"x"}}`, InRequest, []string{"tags.b: must be an integer"}},
+		{"missing required", `{"elements":["fire"]}`, InRequest, []string{"active: is required"}},
+		{"unknown property", `{"elements":["fire"],"active":true,"colour":"red"}`, InRequest, []string{"colour: is not allowed"}},
+		{"wrong types", `{"elements":"fire","active":"yes"}`, InRequest, []string{"active: must be a boolean", "elements: must be an array"}},
+		{"fraction for an integer", `{"id":1.5,"elements":["fire"],"active":true}`, InResponse, []string{"id: must be an integer"}},
+		{"enum", `{"elements":["grass"],"active":true}`, InRequest, []string{"elements[0]: must be one of fire, water"}},
+		{"too few items", `{"elements":[],"active":true}`, InRequest, []string{"elements: must have at least 1 items"}},
+		{"too many items", `{"elements":["fire","water","fire"],"active":true}`, InRequest, []string{"elements: must have at most 2 items"}},
+		{"below minimum", `{"elements":["fire"],"active":true,"score":-1}`, InRequest, []string{"score: must be at least 0"}},
+		{"too short", `{"elements":["fire"],"active":true,"motto":"a"}`, InRequest, []string{"motto: must be at least 2 characters"}},
+		{"null", `{"elements":["fire"],"active":null}`, InRequest, []string{"active: must not be null"}},
+		{"not an object", `[1]`, InRequest, []string{"must be an object"}},
+		{"malformed", `{"elements":`, InRequest, []string{"body must be valid JSON"}},
+		{"trailing value", `{"elements":["fire"],"active":true} {}`, InRequest, []string{"body must have only a single JSON value"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := fields(ValidateJSON(mt.Schema, []byte(tc.body), tc.dir))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	op := loadTestSpec(t)
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		query string
+		trace string
+		want  []string
+	}{
+		{"valid", "red", "limit=10", "abc", nil},
+		{"optional query left out", "red", "", "abc", nil},
+		{"missing header", "red", "", "", []string{"X-Trace: is required"}},
+		{"path too long", "rocket-team", "", "abc", []string{"name: must be at most 8 characters"}},
+		{"not an integer", "red", "limit=ten", "abc", []string{"limit: must be an integer"}},
+		{"out of range", "red", "limit=101", "abc", []string{"limit: must be at most 100"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/teams/"+tc.path+"?"+tc.query, nil)
+			if tc.trace != "" {
+				r.Header.Set("X-Trace", tc.trace)
+			}
+			got := fields(op.ValidateParameters(r, map[string]string{"name": tc.path}))
+			if !slices.Equal(got, tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	doc, err := Load([]byte(testSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, params, ok := doc.Find("PUT", "/teams/blue"); !ok || params["name"] != "blue" {
+		t.Errorf("PUT /teams/blue: %v %v", params, ok)
+	}
+	if _, _, ok := doc.Find("GET", "/teams/blue"); ok {
+		t.Error("GET /teams/blue matched a PUT operation")
+	}
+	if _, _, ok := doc.Find("PUT", "/teams/blue/members"); ok {
+		t.Error("a longer path matched")
+	}
+}
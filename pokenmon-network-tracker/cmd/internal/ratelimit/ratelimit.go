@@ -0,0 +1,227 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Rule is a token bucket: Rate tokens are added per second up to Burst.
+type Rule struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Limits is the runtime-configurable limiter configuration.
+type Limits struct {
+	// Default applies to every route without an entry in Routes.
+	Default Rule `json:"default"`
+	// Routes is keyed by "METHOD /path", e.g. "POST /v1/sightings".
+	Routes map[string]Rule `json:"routes,omitempty"`
+	// DailyQuota is the number of sightings a team may submit per UTC day, 0 means unlimited.
+	DailyQuota int `json:"dailyQuota"`
+	// TeamQuotas overrides DailyQuota for specific teams.
+	TeamQuotas map[string]int `json:"teamQuotas,omitempty"`
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		Default: Rule{Rate: 50, Burst: 100},
+		Routes: map[string]Rule{
+			"POST /v1/sightings": {Rate: 10, Burst: 20},
+		},
+	}
+}
+
+func (l Limits) Validate() error {
+	check := func(name string, r Rule) error {
+		if r.Rate <= 0 || r.Burst < 1 {
+			return fmt.Errorf("%s: rate must be > 0 and burst >= 1", name)
+		}
+		return nil
+	}
+	if err := check("default", l.Default); err != nil {
+		return err
+	}
+	for route, r := range l.Routes {
+		if err := check(route, r); err != nil {
+			return err
+		}
+	}
+	if l.DailyQuota < 0 {
+		return errors.New("dailyQuota must be >= 0")
+	}
+	for team, q := range l.TeamQuotas {
+		if q < 0 {
+			return fmt.Errorf("quota for team %s must be >= 0", team)
+		}
+	}
+	return nil
+}
+
+func (l Limits) rule(route string) Rule {
+	if r, ok := l.Routes[route]; ok {
+		return r
+	}
+	return l.Default
+}
+
+func (l Limits) quota(team string) int {
+	if q, ok := l.TeamQuotas[team]; ok {
+		return q
+	}
+	return l.DailyQuota
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type usage struct {
+	day   string
+	count int
+}
+
+// Limiter holds the token buckets per route and client and the daily team usage.
+type Limiter struct {
+	mu      sync.Mutex
+	limits  Limits
+	buckets map[string]*bucket
+	usage   map[string]*usage
+	now     func() time.Time
+}
+
+func NewLimiter(limits Limits) *Limiter {
+	return &Limiter{
+		limits:  limits,
+		buckets: make(map[string]*bucket),
+		usage:   make(map[string]*usage),
+		now:     time.Now,
+	}
+}
+
+func (l *Limiter) Limits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+// SetLimits replaces the configuration. Existing buckets keep their tokens,
+// capped at the new burst on their next use.
+func (l *Limiter) SetLimits(limits Limits) error {
+	if err := limits.Validate(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	return nil
+}
+
+// Allow takes a token from the client's bucket for route. When the bucket is
+// empty it returns false and how long until the next token is available.
+func (l *Limiter) Allow(route, client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rule := l.limits.rule(route)
+	now := l.now()
+	key := route + "|" + client
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*rule.Rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	return false, wait
+}
+
+// Charge is a sighting counted by UseQuota.
+type Charge struct {
+	Team string
+	// Day is the UTC day the sighting counted against, empty when the team has no quota.
+	Day string
+	// Remaining is what is left of the quota, -1 when the team has none.
+	Remaining int
+	// Reset is when the quota starts over.
+	Reset time.Time
+}
+
+// UseQuota counts one sighting against the team's daily quota. It returns
+// false once the quota is used up.
+func (l *Limiter) UseQuota(team string) (Charge, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now().UTC()
+	c := Charge{
+		Team:      team,
+		Remaining: -1,
+		Reset:     time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC),
+	}
+	quota := l.limits.quota(team)
+	if quota == 0 {
+		return c, true
+	}
+
+	day := now.Format(time.DateOnly)
+	u, ok := l.usage[team]
+	if !ok || u.day != day {
+		u = &usage{day: day}
+		l.usage[team] = u
+	}
+	if u.count >= quota {
+		c.Remaining = 0
+		return c, false
+	}
+	u.count++
+	c.Day, c.Remaining = day, quota-u.count
+	return c, true
+}
+
+// Refund gives back a sighting counted by UseQuota, e.g. when the submission was rejected.
+// A charge made before the quota reset is not refunded against the new day.
+func (l *Limiter) Refund(c Charge) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if u, ok := l.usage[c.Team]; ok && c.Day != "" && u.day == c.Day && u.count > 0 {
+		u.count--
+	}
+}
+
+// Usage returns today's sighting count per team.
+func (l *Limiter) Usage() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	day := l.now().UTC().Format(time.DateOnly)
+	out := make(map[string]int, len(l.usage))
+	for team, u := range l.usage {
+		if u.day == day {
+			out[team] = u.count
+		}
+	}
+	return out
+}
+
+// Cleanup drops buckets that have been idle for longer than idle.
+func (l *Limiter) Cleanup(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > idle {
+			delete(l.buckets, key)
+		}
+	}
+}
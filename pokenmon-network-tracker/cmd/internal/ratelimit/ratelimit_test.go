@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefundOnlyTheChargedDay(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 59, 59, 0, time.UTC)
+	l := NewLimiter(Limits{Default: Rule{Rate: 1, Burst: 1}, DailyQuota: 2})
+	l.now = func() time.Time { return now }
+
+	late, ok := l.UseQuota("red")
+	if !ok || late.Remaining != 1 || late.Day != "2026-03-01" {
+		t.Fatalf("charge = %+v, %v", late, ok)
+	}
+
+	// the day rolls over while the submission is in flight
+	now = now.Add(2 * time.Second)
+	if _, ok := l.UseQuota("red"); !ok {
+		t.Fatal("new day started without quota")
+	}
+	l.Refund(late)
+	if got := l.Usage()["red"]; got != 1 {
+		t.Errorf("usage after refunding yesterday's charge = %d, want 1", got)
+	}
+
+	today, _ := l.UseQuota("red")
+	if _, ok := l.UseQuota("red"); ok {
+		t.Fatal("quota of 2 allowed a third sighting")
+	}
+	l.Refund(today)
+	if got := l.Usage()["red"]; got != 1 {
+		t.Errorf("usage after refund = %d, want 1", got)
+	}
+}
+
+func TestRefundWithoutQuota(t *testing.T) {
+	l := NewLimiter(Limits{Default: Rule{Rate: 1, Burst: 1}, TeamQuotas: map[string]int{"blue": 1}})
+	free, ok := l.UseQuota("red")
+	if !ok || free.Remaining != -1 || free.Day != "" {
+		t.Fatalf("charge = %+v, %v", free, ok)
+	}
+	l.Refund(free)
+	l.Refund(Charge{})
+
+	if _, ok := l.UseQuota("blue"); !ok {
+		t.Fatal("first blue sighting refused")
+	}
+	if c, ok := l.UseQuota("blue"); ok || c.Remaining != 0 {
+		t.Errorf("second blue sighting = %+v, %v", c, ok)
+	}
+}
@@ -0,0 +1,298 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"pokemonSightingApp/cmd/internal/broadcast"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, keyed by the subscription secret.
+const SignatureHeader = "X-PTN-Signature"
+
+// EventHeader carries the event type of the delivery.
+const EventHeader = "X-PTN-Event"
+
+const maxDeliveryLog = 100
+
+// Deliveries wait in a queue of queueSize for one of workers to post them, so
+// an endpoint that is down holds up at most that many goroutines.
+const (
+	queueSize = 256
+	workers   = 4
+)
+
+var ErrNotFound = errors.New("webhook subscription not found")
+
+type Subscription struct {
+	Id        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Elements  []string  `json:"elements,omitempty"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Delivery records a single attempt to deliver an event to a subscription.
+type Delivery struct {
+	SubscriptionId string    `json:"subscriptionId"`
+	Event          string    `json:"event"`
+	Attempt        int       `json:"attempt"`
+	StatusCode     int       `json:"statusCode,omitempty"`
+	Error          string    `json:"error,omitempty"`
+	Success        bool      `json:"success"`
+	Time           time.Time `json:"time"`
+}
+
+// Manager owns the webhook subscriptions and delivers matching hub events to them.
+// It implements broadcast.Broadcaster so it can be registered as a sink.
+type Manager struct {
+	mu            sync.RWMutex
+	subscriptions map[string]*Subscription
+	deliveries    map[string][]Delivery
+
+	Client     *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+
+	queue  chan job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// job is one event on its way to one subscription.
+type job struct {
+	s           Subscription
+	messageType string
+	body        []byte
+}
+
+// NewManager starts the delivery workers; Close stops them.
+func NewManager() *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Manager{
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make(map[string][]Delivery),
+		Client:        &http.Client{Timeout: 5 * time.Second},
+		MaxRetries:    5,
+		Backoff:       500 * time.Millisecond,
+		queue:         make(chan job, queueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	m.wg.Add(workers)
+	for range workers {
+		go m.work()
+	}
+	return m
+}
+
+func (m *Manager) work() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case j := <-m.queue:
+			m.deliver(j.s, j.messageType, j.body)
+		}
+	}
+}
+
+// Close abandons the queued deliveries and the retries in progress and waits
+// for the workers to stop.
+func (m *Manager) Close() {
+	m.cancel()
+	m.wg.Wait()
+}
+
+// Subscribe validates and registers a new subscription.
+func (m *Manager) Subscribe(s Subscription) (Subscription, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return s, fmt.Errorf("invalid webhook url: %q", s.URL)
+	}
+	if len(s.Events) == 0 {
+		return s, errors.New("at least one event type is required")
+	}
+
+	s.Id = newId()
+	s.CreatedAt = time.Now()
+
+	m.mu.Lock()
+	m.subscriptions[s.Id] = &s
+	m.mu.Unlock()
+	return s, nil
+}
+
+func (m *Manager) Unsubscribe(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.subscriptions, id)
+	delete(m.deliveries, id)
+	return nil
+}
+
+// List returns all subscriptions with their secrets redacted.
+func (m *Manager) List() []Subscription {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]Subscription, 0, len(m.subscriptions))
+	for _, s := range m.subscriptions {
+		c := *s
+		c.Secret = ""
+		out = append(out, c)
+	}
+	slices.SortFunc(out, func(a, b Subscription) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return out
+}
+
+// Deliveries returns the most recent delivery attempts for a subscription.
+func (m *Manager) Deliveries(id string) ([]Delivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if _, ok := m.subscriptions[id]; !ok {
+		return nil, ErrNotFound
+	}
+	return slices.Clone(m.deliveries[id]), nil
+}
+
+func (m *Manager) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	var targets []Subscription
+	m.mu.RLock()
+	for _, s := range m.subscriptions {
+		if s.matches(messageType, options) {
+			targets = append(targets, *s)
+		}
+	}
+	m.mu.RUnlock()
+	if len(targets) == 0 {
+		return
+	}
+
+	message, err := broadcast.NewMessage(msg, messageType, includeTime, options)
+	if err != nil {
+		log.Printf("error - %v", err)
+		return
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("failed to marshal webhook event: %v", err)
+		return
+	}
+
+	for _, s := range targets {
+		select {
+		case m.queue <- job{s: s, messageType: messageType, body: body}:
+		default:
+			m.record(Delivery{SubscriptionId: s.Id, Event: messageType, Error: "delivery queue full", Time: time.Now()})
+		}
+	}
+}
+
+func (s *Subscription) matches(messageType string, options map[string]any) bool {
+	if !slices.Contains(s.Events, messageType) {
+		return false
+	}
+	if len(s.Elements) == 0 {
+		return true
+	}
+	element, _ := options["element"].(string)
+	return slices.Contains(s.Elements, element)
+}
+
+// deliver posts the event, retrying with exponential backoff until it succeeds,
+// MaxRetries attempts have been made or the manager is closed.
+func (m *Manager) deliver(s Subscription, messageType string, body []byte) {
+	backoff := m.Backoff
+	for attempt := 1; attempt <= m.MaxRetries; attempt++ {
+		d := m.attempt(s, messageType, body)
+		d.Attempt = attempt
+		m.record(d)
+		if d.Success {
+			return
+		}
+		if attempt == m.MaxRetries {
+			break
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-m.ctx.Done():
+			return
+		}
+	}
+	log.Printf("webhook %s gave up delivering %q after %d attempts", s.Id, messageType, m.MaxRetries)
+}
+
+func (m *Manager) attempt(s Subscription, messageType string, body []byte) Delivery {
+	d := Delivery{SubscriptionId: s.Id, Event: messageType, Time: time.Now()}
+
+	req, err := http.NewRequestWithContext(m.ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, messageType)
+	if s.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(s.Secret, body))
+	}
+
+	resp, err := m.Client.Do(req)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	resp.Body.Close()
+
+	d.StatusCode = resp.StatusCode
+	d.Success = resp.StatusCode >= 200 && resp.StatusCode < 300
+	if !d.Success {
+		d.Error = resp.Status
+	}
+	return d
+}
+
+func (m *Manager) record(d Delivery) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[d.SubscriptionId]; !ok {
+		return
+	}
+	log := append(m.deliveries[d.SubscriptionId], d)
+	if len(log) > maxDeliveryLog {
+		log = log[len(log)-maxDeliveryLog:]
+	}
+	m.deliveries[d.SubscriptionId] = log
+}
+
+// Sign returns the hex HMAC-SHA256 of body using secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newId() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,138 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDeliverSignsAndRetries(t *testing.T) {
+	var calls atomic.Int32
+	signatures := make(chan string, 10)
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signatures <- r.Header.Get(SignatureHeader)
+		bodies <- body
+		if r.Header.Get(EventHeader) != "pokemon capture" {
+			t.Errorf("event header = %q", r.Header.Get(EventHeader))
+		}
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	m := NewManager()
+	defer m.Close()
+	m.Backoff = time.Millisecond
+	s, err := m.Subscribe(Subscription{URL: srv.URL, Events: []string{"pokemon capture"}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Broadcast("Pikachu captured", "pokemon escape", true, nil)
+	m.Broadcast("Pikachu captured", "pokemon capture", true, map[string]any{"element": "lighting"})
+
+	var deliveries []Delivery
+	waitFor(t, func() bool {
+		deliveries, _ = m.Deliveries(s.Id)
+		return len(deliveries) == 3
+	})
+	for i, d := range deliveries {
+		if d.Attempt != i+1 || d.Success != (i == 2) {
+			t.Errorf("delivery %d = %+v", i, d)
+		}
+	}
+	if deliveries[0].StatusCode != http.StatusInternalServerError || deliveries[2].StatusCode != http.StatusNoContent {
+		t.Errorf("status codes = %d, %d", deliveries[0].StatusCode, deliveries[2].StatusCode)
+	}
+	for range 3 {
+		if sig, body := <-signatures, <-bodies; sig != "sha256="+Sign("s3cret", body) {
+			t.Errorf("signature %q does not match the body", sig)
+		}
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("endpoint called %d times, want 3", n)
+	}
+}
+
+func TestElementFilter(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer srv.Close()
+
+	m := NewManager()
+	defer m.Close()
+	s, _ := m.Subscribe(Subscription{URL: srv.URL, Events: []string{"pokemon escape"}, Elements: []string{"fire"}})
+
+	m.Broadcast("escaped", "pokemon escape", true, map[string]any{"element": "water"})
+	m.Broadcast("escaped", "pokemon escape", true, map[string]any{"element": "fire"})
+	waitFor(t, func() bool {
+		d, _ := m.Deliveries(s.Id)
+		return len(d) == 1
+	})
+	if n := calls.Load(); n != 1 {
+		t.Errorf("endpoint called %d times, want 1", n)
+	}
+}
+
+func TestCloseStopsRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	m := NewManager()
+	m.Backoff = time.Hour
+	s, _ := m.Subscribe(Subscription{URL: srv.URL, Events: []string{"alert"}})
+	m.Broadcast("firing", "alert", true, nil)
+	waitFor(t, func() bool {
+		d, _ := m.Deliveries(s.Id)
+		return len(d) == 1
+	})
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the retry backoff")
+	}
+}
+
+func TestSubscribeValidates(t *testing.T) {
+	m := NewManager()
+	defer m.Close()
+	for _, s := range []Subscription{
+		{URL: "ftp://example.com", Events: []string{"alert"}},
+		{URL: "http://", Events: []string{"alert"}},
+		{URL: "http://example.com"},
+	} {
+		if _, err := m.Subscribe(s); err == nil {
+			t.Errorf("Subscribe(%+v) accepted", s)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+	"log"
+)
+
+// ResetSystem stops every agent, purges the task queues and clears the escape count.
+// A failed purge is logged but does not fail the reset.
+func (s *Service) ResetSystem(ctx context.Context) error {
+	if err := s.ResetAgents(ctx); err != nil {
+		return err
+	}
+	// Reset queues to clear stale consumer metadata
+	if err := s.broker.PurgeQueues(); err != nil {
+		log.Printf("Failed to reset queues: %v", err)
+	}
+	s.escapes.Reset()
+	return nil
+}
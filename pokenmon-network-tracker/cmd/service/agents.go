@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"pokemonSightingApp/cmd/event"
+	"strings"
+)
+
+// SpawnAgent allocates an id and asks the agent workers to start a rocket agent.
+// The agent shows up in ListAgents once a worker has picked up the command; a
+// worker that turns it down reports an "agent rejected" event instead.
+func (s *Service) SpawnAgent(ctx context.Context, name string, imageNum int) (event.AgentInfo, error) {
+	agent := event.AgentInfo{Name: name, ImageNum: imageNum}
+
+	var v ValidationError
+	if strings.TrimSpace(name) == "" {
+		v.add("name", "is required")
+	}
+	if imageNum < 0 {
+		v.add("imageNum", "must not be negative")
+	}
+	if err := v.err(); err != nil {
+		return agent, err
+	}
+	if s.Draining() {
+		return agent, ErrDraining
+	}
+	if s.fleet.FreeCapacity() == 0 {
+		return agent, ErrNoCapacity
+	}
+
+	agent.Id = s.fleet.NextId()
+	body, err := json.Marshal(agent)
+	if err != nil {
+		return agent, err
+	}
+	if err := s.command(ctx, event.SpawnKey, body); err != nil {
+		return agent, err
+	}
+	return agent, nil
+}
+
+func (s *Service) ListAgents() []event.AgentInfo {
+	return s.fleet.Agents()
+}
+
+func (s *Service) ListWorkers() []event.WorkerInfo {
+	return s.fleet.Workers()
+}
+
+// ResetAgents asks every worker to stop its agents.
+func (s *Service) ResetAgents(ctx context.Context) error {
+	return s.command(ctx, event.StopKey, []byte("{}"))
+}
+
+// DrainAgent asks the worker running agent to stop it once its current task is done.
+func (s *Service) DrainAgent(ctx context.Context, agent event.AgentInfo) error {
+	body, err := json.Marshal(event.AgentInfo{Id: agent.Id, Worker: agent.Worker})
+	if err != nil {
+		return err
+	}
+	return s.command(ctx, event.DrainKey, body)
+}
+
+// ReapAgent asks the worker running agent, which was declared dead, to stop it
+// without waiting for its current task.
+func (s *Service) ReapAgent(ctx context.Context, agent event.AgentInfo) error {
+	body, err := json.Marshal(event.AgentInfo{Id: agent.Id, Worker: agent.Worker})
+	if err != nil {
+		return err
+	}
+	return s.command(ctx, event.ReapKey, body)
+}
+
+// command publishes an agent command on the control exchange.
+func (s *Service) command(ctx context.Context, key string, body []byte) error {
+	return s.broker.Publish(ctx, []Message{{Exchange: s.controlExchange, RoutingKey: key, Body: body}})[0]
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"pokemonSightingApp/cmd/event"
+	"time"
+)
+
+// AutoscaleOptions bounds and tunes the Autoscaler.
+type AutoscaleOptions struct {
+	// TaskQueue is the queue whose backlog is sampled.
+	TaskQueue string
+	Interval  time.Duration
+	MinAgents int
+	MaxAgents int
+	// BacklogPerAgent is how many waiting tasks one agent is expected to keep up with.
+	BacklogPerAgent int
+	// MaxTaskAge and MaxEscapeRate (per minute) add an agent when exceeded.
+	MaxTaskAge        time.Duration
+	MaxEscapeRate     float64
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+	AgentName         string
+}
+
+// Autoscaler keeps the number of rocket agents between MinAgents and MaxAgents,
+// spawning agents when the task queue backs up, tasks wait too long or
+// pokemon escape, and draining idle ones once the queue is empty. Every
+// decision is broadcast as an "autoscale" event with its reason.
+type Autoscaler struct {
+	s    *Service
+	ages *event.TaskAges
+	opts AutoscaleOptions
+
+	// owned by Run
+	escapes   int
+	lastUp    time.Time
+	lastScale time.Time
+}
+
+func NewAutoscaler(s *Service, ages *event.TaskAges, opts AutoscaleOptions) *Autoscaler {
+	return &Autoscaler{s: s, ages: ages, opts: opts}
+}
+
+// sample is what one autoscaler tick observed.
+type sample struct {
+	agents     int
+	backlog    int
+	escapeRate float64
+	taskAge    time.Duration
+}
+
+// Run samples every Interval until ctx is done. It stands still while the service drains.
+func (a *Autoscaler) Run(ctx context.Context) {
+	a.escapes = a.s.EscapeCount()
+	ticker := time.NewTicker(a.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !a.s.Draining() {
+				a.step(ctx)
+			}
+		}
+	}
+}
+
+func (a *Autoscaler) step(ctx context.Context) {
+	stats, err := a.s.broker.QueueStats(ctx, a.opts.TaskQueue)
+	if err != nil {
+		log.Printf("autoscaler: %v", err)
+		return
+	}
+	escapes := a.s.EscapeCount()
+	// the counter starts over on a system reset
+	rate := float64(max(escapes-a.escapes, 0)) / a.opts.Interval.Minutes()
+	a.escapes = escapes
+	age, _ := a.ages.Take()
+
+	agents := a.s.fleet.Agents()
+	smp := sample{agents: len(agents), backlog: stats.Messages, escapeRate: rate, taskAge: age}
+	target, reason := a.target(smp)
+
+	now := time.Now()
+	switch {
+	case target > smp.agents && now.Sub(a.lastUp) >= a.opts.ScaleUpCooldown:
+		a.scaleUp(ctx, smp, target, reason)
+	case target < smp.agents && now.Sub(a.lastScale) >= a.opts.ScaleDownCooldown:
+		a.scaleDown(ctx, smp, agents, reason)
+	}
+}
+
+// target decides how many agents smp calls for, and why.
+func (a *Autoscaler) target(smp sample) (int, string) {
+	n, reason := smp.agents, ""
+	per := a.opts.BacklogPerAgent
+	switch {
+	case smp.backlog > smp.agents*per:
+		n = (smp.backlog + per - 1) / per
+		reason = fmt.Sprintf("%d waiting tasks need %d agents at %d tasks each", smp.backlog, n, per)
+	case smp.taskAge > a.opts.MaxTaskAge:
+		n++
+		reason = fmt.Sprintf("tasks waited %s on average, over %s", smp.taskAge.Round(time.Millisecond), a.opts.MaxTaskAge)
+	case smp.escapeRate > a.opts.MaxEscapeRate:
+		n++
+		reason = fmt.Sprintf("%.1f escapes per minute, over %.1f", smp.escapeRate, a.opts.MaxEscapeRate)
+	case smp.backlog == 0 && smp.escapeRate == 0 && smp.taskAge <= a.opts.MaxTaskAge/2:
+		n--
+		reason = "task queue is empty"
+	}
+
+	switch {
+	case n < a.opts.MinAgents:
+		n = a.opts.MinAgents
+		reason = fmt.Sprintf("below the minimum of %d agents", a.opts.MinAgents)
+	case n > a.opts.MaxAgents:
+		if smp.agents > a.opts.MaxAgents {
+			reason = fmt.Sprintf("above the maximum of %d agents", a.opts.MaxAgents)
+		} else {
+			reason += fmt.Sprintf(", capped at the maximum of %d", a.opts.MaxAgents)
+		}
+		n = a.opts.MaxAgents
+	}
+	return n, reason
+}
+
+func (a *Autoscaler) scaleUp(ctx context.Context, smp sample, target int, reason string) {
+	// spawns only take a slot once a worker reports the agent, so stay within what is free now
+	want := min(target-smp.agents, a.s.fleet.FreeCapacity())
+	if want == 0 {
+		reason += "; " + ErrNoCapacity.Error()
+	}
+	spawned := 0
+	for range want {
+		_, err := a.s.SpawnAgent(ctx, a.opts.AgentName, 0)
+		if err != nil {
+			if !errors.Is(err, ErrNoCapacity) {
+				log.Printf("autoscaler: %v", err)
+			}
+			reason += "; " + err.Error()
+			break
+		}
+		spawned++
+	}
+	// a blocked scale-up waits out the cooldown too, so it is not announced every tick
+	a.lastUp = time.Now()
+	if spawned > 0 {
+		a.lastScale = a.lastUp
+	}
+
+	action := "scale up"
+	msg := fmt.Sprintf("Autoscaler added %d agents (%d -> %d): %s", spawned, smp.agents, smp.agents+spawned, reason)
+	if spawned == 0 {
+		action = "hold"
+		msg = fmt.Sprintf("Autoscaler could not add agents (%d): %s", smp.agents, reason)
+	}
+	a.announce(msg, action, smp, smp.agents+spawned, reason)
+}
+
+func (a *Autoscaler) scaleDown(ctx context.Context, smp sample, agents []event.AgentInfo, reason string) {
+	// drain the newest idle agent; a busy one only to get under the maximum
+	var victim *event.AgentInfo
+	for i := len(agents) - 1; i >= 0; i-- {
+		if !agents[i].Busy {
+			victim = &agents[i]
+			break
+		}
+	}
+	if victim == nil && smp.agents > a.opts.MaxAgents {
+		victim = &agents[len(agents)-1]
+	}
+	if victim == nil {
+		return
+	}
+
+	if err := a.s.DrainAgent(ctx, *victim); err != nil {
+		log.Printf("autoscaler: %v", err)
+		return
+	}
+	a.lastScale = time.Now()
+	msg := fmt.Sprintf("Autoscaler drained rocket agent %d, %s (%d -> %d): %s", victim.Id, victim.Name, smp.agents, smp.agents-1, reason)
+	a.announce(msg, "scale down", smp, smp.agents-1, reason)
+}
+
+func (a *Autoscaler) announce(msg, action string, smp sample, to int, reason string) {
+	a.s.b.Broadcast(msg, "autoscale", true, map[string]any{
+		"action":     action,
+		"reason":     reason,
+		"from":       smp.agents,
+		"to":         to,
+		"min":        a.opts.MinAgents,
+		"max":        a.opts.MaxAgents,
+		"backlog":    smp.backlog,
+		"escapeRate": smp.escapeRate,
+		"taskAge":    smp.taskAge.Seconds(),
+	})
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"pokemonSightingApp/cmd/event"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recorder keeps the events broadcast to it.
+type recorder struct {
+	events []map[string]any
+}
+
+func (r *recorder) Broadcast(msg string, messageType string, includeTime bool, options map[string]any) {
+	r.events = append(r.events, options)
+}
+
+var testScaling = AutoscaleOptions{
+	TaskQueue:       "pokemon_tasks",
+	MinAgents:       1,
+	MaxAgents:       5,
+	BacklogPerAgent: 10,
+	MaxTaskAge:      4 * time.Second,
+	MaxEscapeRate:   2,
+	AgentName:       "Autoscaled",
+}
+
+func TestAutoscalerTarget(t *testing.T) {
+	a := &Autoscaler{opts: testScaling}
+	for _, tc := range []struct {
+		name   string
+		smp    sample
+		want   int
+		reason string
+	}{
+		{"backlog", sample{agents: 1, backlog: 25, taskAge: time.Second}, 3, "25 waiting tasks need 3 agents at 10 tasks each"},
+		{"backlog over the maximum", sample{agents: 2, backlog: 100}, 5, "100 waiting tasks need 10 agents at 10 tasks each, capped at the maximum of 5"},
+		{"old tasks", sample{agents: 2, backlog: 5, taskAge: 5 * time.Second}, 3, "tasks waited 5s on average, over 4s"},
+		{"escapes", sample{agents: 2, backlog: 5, escapeRate: 3}, 3, "3.0 escapes per minute, over 2.0"},
+		{"empty queue", sample{agents: 3}, 2, "task queue is empty"},
+		{"empty queue but tasks still wait", sample{agents: 3, taskAge: 3 * time.Second}, 3, ""},
+		{"empty queue at the minimum", sample{agents: 1}, 1, "below the minimum of 1 agents"},
+		{"no agents", sample{agents: 0, backlog: 3}, 1, "3 waiting tasks need 1 agents at 10 tasks each"},
+		{"above the maximum", sample{agents: 7, backlog: 5, taskAge: 3 * time.Second}, 5, "above the maximum of 5 agents"},
+		{"keeping up", sample{agents: 2, backlog: 5, escapeRate: 1, taskAge: time.Second}, 2, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, reason := a.target(tc.smp)
+			if got != tc.want || reason != tc.reason {
+				t.Errorf("target = %d %q, want %d %q", got, reason, tc.want, tc.reason)
+			}
+		})
+	}
+}
+
+func TestAutoscalerScaleUp(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		capacity int
+		fail     int
+		target   int
+		spawned  int
+		action   string
+		reason   string
+	}{
+		{"spawns the difference", 4, 0, 3, 3, "scale up", "backlog"},
+		{"stays within the free capacity", 2, 0, 3, 2, "scale up", "backlog"},
+		{"no capacity", 0, 0, 3, 0, "hold", "backlog; " + ErrNoCapacity.Error()},
+		{"broker down", 4, 1, 3, 0, "hold", "backlog; " + ErrUnavailable.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, broker, _ := newTestService(tc.capacity)
+			broker.fail = tc.fail
+			events := &recorder{}
+			s.b = events
+			a := NewAutoscaler(s, &event.TaskAges{}, testScaling)
+
+			a.scaleUp(context.Background(), sample{agents: 0, backlog: 30}, tc.target, "backlog")
+			if len(broker.published) != tc.spawned {
+				t.Errorf("published %d spawn commands, want %d", len(broker.published), tc.spawned)
+			}
+			if a.lastUp.IsZero() || a.lastScale.IsZero() != (tc.spawned == 0) {
+				t.Errorf("lastUp %v, lastScale %v", a.lastUp, a.lastScale)
+			}
+			if len(events.events) != 1 {
+				t.Fatalf("announced %d times, want 1", len(events.events))
+			}
+			e := events.events[0]
+			if e["action"] != tc.action || e["to"] != tc.spawned || !strings.HasPrefix(e["reason"].(string), tc.reason) {
+				t.Errorf("announced %v", e)
+			}
+		})
+	}
+}
+
+func TestAutoscalerScaleDown(t *testing.T) {
+	agent := func(id int, busy bool) event.AgentInfo {
+		return event.AgentInfo{Id: id, Name: "Autoscaled", Worker: "worker-1", Busy: busy}
+	}
+	for _, tc := range []struct {
+		name   string
+		agents []event.AgentInfo
+		want   int
+	}{
+		{"newest idle agent", []event.AgentInfo{agent(1, false), agent(2, false), agent(3, true)}, 2},
+		{"every agent busy", []event.AgentInfo{agent(1, true), agent(2, true)}, 0},
+		{"busy agents above the maximum", []event.AgentInfo{agent(1, true), agent(2, true), agent(3, true), agent(4, true), agent(5, true), agent(6, true)}, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, broker, _ := newTestService(1)
+			events := &recorder{}
+			s.b = events
+			a := NewAutoscaler(s, &event.TaskAges{}, testScaling)
+
+			a.scaleDown(context.Background(), sample{agents: len(tc.agents)}, tc.agents, "task queue is empty")
+			if tc.want == 0 {
+				if len(broker.published) != 0 || len(events.events) != 0 || !a.lastScale.IsZero() {
+					t.Errorf("drained %+v", broker.published)
+				}
+				return
+			}
+			if len(broker.published) != 1 || broker.published[0].RoutingKey != event.DrainKey {
+				t.Fatalf("published %+v", broker.published)
+			}
+			var drained event.AgentInfo
+			if err := json.Unmarshal(broker.published[0].Body, &drained); err != nil {
+				t.Fatal(err)
+			}
+			if drained.Id != tc.want || drained.Worker != "worker-1" {
+				t.Errorf("drained %+v, want %d", drained, tc.want)
+			}
+			if len(events.events) != 1 || events.events[0]["action"] != "scale down" || events.events[0]["to"] != len(tc.agents)-1 {
+				t.Errorf("announced %v", events.events)
+			}
+		})
+	}
+}
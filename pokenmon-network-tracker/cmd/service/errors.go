@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalid is matched by every ValidationError.
+	ErrInvalid = errors.New("invalid input")
+	// ErrNotFound means the requested resource does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable means the broker could not be reached.
+	ErrUnavailable = errors.New("broker unavailable")
+	// ErrDraining is returned for new work once shutdown has begun.
+	ErrDraining = errors.New("shutting down, not accepting new work")
+	// ErrNoCapacity means no agent worker has room for another agent.
+	ErrNoCapacity = errors.New("no agent worker has room for another agent")
+)
+
+// FieldError describes a problem with a single input field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, 0, len(v.Fields))
+	for _, f := range v.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "invalid input: " + strings.Join(msgs, "; ")
+}
+
+func (v *ValidationError) Is(target error) bool {
+	return target == ErrInvalid
+}
+
+func (v *ValidationError) add(field, message string) {
+	v.Fields = append(v.Fields, FieldError{Field: field, Message: message})
+}
+
+// err returns nil when no field was invalid.
+func (v *ValidationError) err() error {
+	if len(v.Fields) == 0 {
+		return nil
+	}
+	return v
+}
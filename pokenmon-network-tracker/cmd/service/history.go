@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"log"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/history"
+	"time"
+)
+
+// Sampler records the pipeline's state into a history store every interval:
+//
+//	queue.<name>.ready, .unacked, .total, .consumers   per pipeline queue
+//	captures, escapes                                  count since the previous sample
+//	captures.total, escapes.total                      running totals, carried over from the store across restarts
+//	escapes.ratio                                      escapes / (captures + escapes) since the previous sample
+//	agents, agents.busy, agents.stale, workers
+//	heartbeat.dispatcher, heartbeat.dlq-logger         seconds since the process last reported
+type Sampler struct {
+	s          *Service
+	store      *history.Store
+	captures   *event.CaptureCounter
+	components *event.Components
+	interval   time.Duration
+
+	// owned by Run
+	lastCaptures  int
+	lastEscapes   int
+	totalCaptures float64
+	totalEscapes  float64
+}
+
+// SampledMetrics lists every metric a Sampler records for the pipeline queues.
+func SampledMetrics(queues []string) []string {
+	var out []string
+	for _, q := range queues {
+		for _, stat := range []string{"ready", "unacked", "total", "consumers"} {
+			out = append(out, "queue."+q+"."+stat)
+		}
+	}
+	out = append(out, "captures", "escapes", "captures.total", "escapes.total", "escapes.ratio",
+		"agents", "agents.busy", "agents.stale", "workers")
+	for _, name := range heartbeatComponents {
+		out = append(out, "heartbeat."+name)
+	}
+	return out
+}
+
+// heartbeatComponents are the processes whose silence is sampled.
+var heartbeatComponents = []string{event.DispatcherComponent, event.DLQLoggerComponent}
+
+func NewSampler(s *Service, store *history.Store, captures *event.CaptureCounter, components *event.Components, interval time.Duration) *Sampler {
+	return &Sampler{s: s, store: store, captures: captures, components: components, interval: interval}
+}
+
+// Run samples every interval until ctx is done.
+func (sm *Sampler) Run(ctx context.Context) {
+	sm.start()
+	ticker := time.NewTicker(sm.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := sm.store.Record(sm.sample(ctx, now)); err != nil {
+				log.Printf("history: %v", err)
+			}
+		}
+	}
+}
+
+// start takes the counters as they are now and the totals from the newest
+// sample, which a store backed by a file kept from before a restart.
+func (sm *Sampler) start() {
+	sm.lastCaptures, sm.lastEscapes = sm.captures.Get(), sm.s.EscapeCount()
+	if latest, ok := sm.store.Latest(); ok {
+		sm.totalCaptures, sm.totalEscapes = latest.Values["captures.total"], latest.Values["escapes.total"]
+	}
+}
+
+func (sm *Sampler) sample(ctx context.Context, now time.Time) history.Sample {
+	values := make(map[string]float64)
+
+	// a broker outage leaves the queue metrics out of this sample
+	queues, err := sm.s.PipelineQueueStats(ctx)
+	if err != nil {
+		log.Printf("history: %v", err)
+	}
+	for _, q := range queues {
+		prefix := "queue." + q.Name + "."
+		values[prefix+"ready"] = float64(q.MessagesReady)
+		values[prefix+"unacked"] = float64(q.MessagesUnacknowledged)
+		values[prefix+"total"] = float64(q.MessagesTotal)
+		values[prefix+"consumers"] = float64(q.Consumers)
+	}
+
+	captures, escapes := sm.captures.Get(), sm.s.EscapeCount()
+	// the escape count starts over on a system reset
+	captured, escaped := float64(max(captures-sm.lastCaptures, 0)), float64(max(escapes-sm.lastEscapes, 0))
+	values["captures"] = captured
+	values["escapes"] = escaped
+	values["escapes.ratio"] = 0
+	if captured+escaped > 0 {
+		values["escapes.ratio"] = escaped / (captured + escaped)
+	}
+	sm.totalCaptures += captured
+	sm.totalEscapes += escaped
+	values["captures.total"] = sm.totalCaptures
+	values["escapes.total"] = sm.totalEscapes
+	sm.lastCaptures, sm.lastEscapes = captures, escapes
+
+	var busy, stale int
+	agents := sm.s.ListAgents()
+	for _, a := range agents {
+		if a.Busy {
+			busy++
+		}
+		if a.State == event.AgentStale {
+			stale++
+		}
+	}
+	values["agents"] = float64(len(agents))
+	values["agents.busy"] = float64(busy)
+	values["agents.stale"] = float64(stale)
+	values["workers"] = float64(len(sm.s.ListWorkers()))
+
+	for _, name := range heartbeatComponents {
+		values["heartbeat."+name] = sm.components.Silence(name).Seconds()
+	}
+
+	return history.Sample{Time: now, Values: values}
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/history"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSamplerCarriesTotalsOverARestart(t *testing.T) {
+	s, _, _ := newTestService(1)
+	store := history.NewStore(10)
+	// what the store loaded from the file the previous process wrote
+	if err := store.Record(history.Sample{Time: time.Now(), Values: map[string]float64{"captures.total": 10, "escapes.total": 3}}); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := NewSampler(s, store, &event.CaptureCounter{}, event.NewComponents(), time.Minute)
+	sm.start()
+	values := sm.sample(context.Background(), time.Now()).Values
+	if values["captures.total"] != 10 || values["escapes.total"] != 3 || values["captures"] != 0 {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestSamplerStartsFromZero(t *testing.T) {
+	s, _, _ := newTestService(1)
+	sm := NewSampler(s, history.NewStore(10), &event.CaptureCounter{}, event.NewComponents(), time.Minute)
+	sm.start()
+	values := sm.sample(context.Background(), time.Now()).Values
+	if values["captures.total"] != 0 || values["escapes.total"] != 0 || values["escapes.ratio"] != 0 || values["workers"] != 1 {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestSampledMetricsCoverEverySample(t *testing.T) {
+	s, broker, _ := newTestService(1)
+	s.queues = []string{"pokemon_tasks"}
+	broker.queues = map[string]QueueStats{"pokemon_tasks": {Name: "pokemon_tasks"}}
+	sm := NewSampler(s, history.NewStore(10), &event.CaptureCounter{}, event.NewComponents(), time.Minute)
+	sm.start()
+
+	known := SampledMetrics(s.queues)
+	values := sm.sample(context.Background(), time.Now()).Values
+	if len(values) != len(known) {
+		t.Errorf("sampled %d metrics, SampledMetrics lists %d", len(values), len(known))
+	}
+	for metric := range values {
+		if !slices.Contains(known, metric) {
+			t.Errorf("SampledMetrics is missing %s", metric)
+		}
+	}
+}
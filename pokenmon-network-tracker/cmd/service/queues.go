@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+func (s *Service) QueueStats(ctx context.Context, name string) (QueueStats, error) {
+	if name == "" {
+		var v ValidationError
+		v.add("name", "is required")
+		return QueueStats{}, v.err()
+	}
+	return s.broker.QueueStats(ctx, name)
+}
+
+// PipelineQueueStats returns the stats of every pipeline queue. Queues that
+// were not declared yet are left out; any other error ends the walk.
+func (s *Service) PipelineQueueStats(ctx context.Context) ([]QueueStats, error) {
+	out := make([]QueueStats, 0, len(s.queues))
+	for _, name := range s.queues {
+		qs, err := s.broker.QueueStats(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, qs)
+	}
+	return out, nil
+}
+
+// EscapeCount returns how many capture tasks expired into the dead letter queue.
+func (s *Service) EscapeCount() int {
+	return s.escapes.Get()
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"pokemonSightingApp/cmd/internal/rabbitmgmt"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	publishBatchSize = 100
+	confirmTimeout   = 10 * time.Second
+	// mgmtRetry is how long queue stats skip the management API after it
+	// failed, so an outage does not cost a timeout for every queue
+	mgmtRetry = 30 * time.Second
+)
+
+// RabbitBroker implements Broker on a RabbitMQ connection. Queue stats come
+// from the management API when mgmt is set, with passive declares as fallback.
+type RabbitBroker struct {
+	conn *amqp.Connection
+	topo event.Topology
+	mgmt *rabbitmgmt.Client
+	// mgmtFailing keeps a management API outage to one log line
+	mgmtFailing atomic.Bool
+	// mgmtRetryAt is when the management API is tried again, in unix nanoseconds
+	mgmtRetryAt atomic.Int64
+}
+
+func NewRabbitBroker(conn *amqp.Connection, topo event.Topology, mgmt *rabbitmgmt.Client) *RabbitBroker {
+	return &RabbitBroker{conn: conn, topo: topo, mgmt: mgmt}
+}
+
+// Publish sends msgs in batches of publishBatchSize on a confirm-mode channel.
+func (r *RabbitBroker) Publish(ctx context.Context, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	failFrom := func(i int, err error) []error {
+		for ; i < len(errs); i++ {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+		return errs
+	}
+
+	if r.conn == nil || r.conn.IsClosed() {
+		return failFrom(0, ErrUnavailable)
+	}
+	ch, err := r.conn.Channel()
+	if err != nil {
+		return failFrom(0, fmt.Errorf("%w: %v", ErrUnavailable, err))
+	}
+	defer ch.Close()
+	if err := ch.Confirm(false); err != nil {
+		return failFrom(0, err)
+	}
+
+	for start := 0; start < len(msgs); start += publishBatchSize {
+		end := min(start+publishBatchSize, len(msgs))
+		confirms := make([]*amqp.DeferredConfirmation, end-start)
+
+		var published int
+		for i := start; i < end; i++ {
+			m := msgs[i]
+			confirms[i-start], err = ch.PublishWithDeferredConfirmWithContext(ctx, m.Exchange, m.RoutingKey, false, false, amqp.Publishing{
+				ContentType: "application/json",
+				Body:        m.Body,
+			})
+			if err != nil {
+				break
+			}
+			published++
+		}
+
+		for i := 0; i < published; i++ {
+			errs[start+i] = waitConfirm(ctx, confirms[i])
+		}
+		if err != nil {
+			return failFrom(start+published, err)
+		}
+	}
+	return errs
+}
+
+func waitConfirm(ctx context.Context, c *amqp.DeferredConfirmation) error {
+	ctx, cancel := context.WithTimeout(ctx, confirmTimeout)
+	defer cancel()
+	acked, err := c.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return errors.New("broker did not confirm the message")
+	}
+	return nil
+}
+
+func (r *RabbitBroker) QueueStats(ctx context.Context, name string) (QueueStats, error) {
+	if r.mgmt != nil && time.Now().UnixNano() >= r.mgmtRetryAt.Load() {
+		q, err := r.mgmt.Queue(ctx, name)
+		switch {
+		case err == nil:
+			if r.mgmtFailing.Swap(false) {
+				log.Println("management api is back, queue stats include unacked messages and rates again")
+			}
+			return managementStats(q), nil
+		case errors.Is(err, rabbitmgmt.ErrNotFound):
+			return QueueStats{}, fmt.Errorf("queue %s: %w", name, ErrNotFound)
+		case ctx.Err() != nil:
+			return QueueStats{}, ctx.Err()
+		}
+		r.mgmtRetryAt.Store(time.Now().Add(mgmtRetry).UnixNano())
+		if !r.mgmtFailing.Swap(true) {
+			log.Printf("management api unavailable, falling back to passive declares: %v", err)
+		}
+	}
+
+	if r.conn == nil {
+		return QueueStats{}, ErrUnavailable
+	}
+	qs, err := event.GetQueueStats(r.conn, name)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return QueueStats{}, fmt.Errorf("queue %s: %w", name, ErrNotFound)
+	}
+	return QueueStats(qs), err
+}
+
+func managementStats(q rabbitmgmt.Queue) QueueStats {
+	publish, ack := q.MessageStats.PublishDetails.Rate, q.MessageStats.AckDetails.Rate
+	return QueueStats{
+		Name:                   q.Name,
+		Messages:               q.MessagesReady,
+		Consumers:              q.Consumers,
+		MessagesReady:          q.MessagesReady,
+		MessagesUnacknowledged: q.MessagesUnacknowledged,
+		MessagesTotal:          q.Messages,
+		PublishRate:            &publish,
+		AckRate:                &ack,
+		ConsumerUtilisation:    q.ConsumerUtilisation,
+		Source:                 event.StatsFromManagement,
+	}
+}
+
+func (r *RabbitBroker) PurgeQueues() error {
+	if r.conn == nil {
+		return ErrUnavailable
+	}
+	return event.ResetAllQueues(r.conn, r.topo)
+}
+
+// StartTeam sets up a sighting team and starts its listener.
+func (r *RabbitBroker) StartTeam(name string, elements []string, b broadcast.Broadcaster) (Team, error) {
+	if r.conn == nil {
+		return Team{Name: name, Elements: elements}, ErrUnavailable
+	}
+	team, err := event.NewTeam(r.conn, r.topo.Exchange, name, elements, b)
+	if err != nil {
+		return Team{Name: name, Elements: elements}, err
+	}
+
+	go func() {
+		if err := team.Listen(); err != nil {
+			log.Printf("team %s listen failed: %v", name, err)
+		}
+	}()
+	return Team{Name: team.Name, Elements: team.Elements, Topics: team.Topics}, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/rabbitmgmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestQueueStatsSkipTheManagementAPIAfterAFailure(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	mgmt, err := rabbitmgmt.NewClient(srv.URL, "", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no AMQP connection to fall back on
+	broker := NewRabbitBroker(nil, event.Topology{}, mgmt)
+	s := New(broker, discard{}, event.NewFleet(time.Minute, 2*time.Minute), &event.EscapeCounter{}, Options{
+		Queues: []string{"pokemon_sightings", "pokemon_tasks", "dead_letter_tasks"},
+	})
+
+	if _, err := s.PipelineQueueStats(context.Background()); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+	if _, err := s.QueueStats(context.Background(), "pokemon_tasks"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("management api called %d times, want 1", n)
+	}
+
+	broker.mgmtRetryAt.Store(0)
+	if _, err := s.QueueStats(context.Background(), "pokemon_tasks"); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("err = %v, want ErrUnavailable", err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("management api called %d times after the retry delay, want 2", n)
+	}
+}
+
+func TestQueueStatsPassTheContextToTheManagementAPI(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	mgmt, err := rabbitmgmt.NewClient(srv.URL, "", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := NewRabbitBroker(nil, event.Topology{}, mgmt)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := broker.QueueStats(ctx, "pokemon_tasks"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("took %s", took)
+	}
+	// the caller gave up; that says nothing about the management API
+	if broker.mgmtRetryAt.Load() != 0 {
+		t.Error("a cancelled call paused the management API")
+	}
+}
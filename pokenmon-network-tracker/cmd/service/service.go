@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"math/rand"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"sync/atomic"
+	"time"
+)
+
+// Broker is the part of the message broker the service depends on.
+// RabbitBroker implements it on top of RabbitMQ; tests can swap in a fake.
+// It deals in plain values only, so nothing above it holds on to a connection.
+type Broker interface {
+	// Publish sends msgs and returns one error per message, nil once the broker confirmed it.
+	Publish(ctx context.Context, msgs []Message) []error
+	QueueStats(ctx context.Context, name string) (QueueStats, error)
+	PurgeQueues() error
+	StartTeam(name string, elements []string, b broadcast.Broadcaster) (Team, error)
+}
+
+// Message is a single publish to an exchange.
+type Message struct {
+	Exchange   string
+	RoutingKey string
+	Body       []byte
+}
+
+// QueueStats describes a queue's backlog. Messages counts the ready messages.
+// Unacknowledged counts, rates and utilisation come from the management API
+// only; Source tells where the numbers came from.
+type QueueStats struct {
+	Name      string `json:"name"`
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+
+	MessagesReady          int `json:"messages_ready"`
+	MessagesUnacknowledged int `json:"messages_unacknowledged"`
+	MessagesTotal          int `json:"messages_total"`
+	// PublishRate and AckRate are messages per second.
+	PublishRate         *float64 `json:"publish_rate,omitempty"`
+	AckRate             *float64 `json:"ack_rate,omitempty"`
+	ConsumerUtilisation *float64 `json:"consumer_utilisation,omitempty"`
+	Source              string   `json:"source"`
+}
+
+// Team is a sighting team listening to the sightings of its elements.
+type Team struct {
+	Name     string   `json:"name"`
+	Elements []string `json:"elements"`
+	Topics   []string `json:"topics"`
+}
+
+// Options carries the settings the domain logic needs.
+type Options struct {
+	// Exchange is where sightings are published.
+	Exchange string
+	// ControlExchange is where agent commands for the workers are published.
+	ControlExchange string
+	// Queues are the pipeline queues PipelineQueueStats reports on.
+	Queues []string
+	// MinCaptureTime and MaxCaptureTime bound how long a sighting stays catchable.
+	MinCaptureTime time.Duration
+	MaxCaptureTime time.Duration
+}
+
+// Service holds the domain logic shared by the HTTP and gRPC transports.
+type Service struct {
+	broker          Broker
+	exchange        string
+	controlExchange string
+	queues          []string
+	b               broadcast.Broadcaster
+	fleet           *event.Fleet
+	escapes         *event.EscapeCounter
+	// draining is set once shutdown begins; new work is refused from then on
+	draining atomic.Bool
+
+	// CaptureTime rolls how many seconds a sighting stays catchable.
+	CaptureTime func() int
+}
+
+func New(broker Broker, b broadcast.Broadcaster, fleet *event.Fleet, escapes *event.EscapeCounter, opts Options) *Service {
+	minSeconds := int(opts.MinCaptureTime / time.Second)
+	maxSeconds := int(opts.MaxCaptureTime / time.Second)
+	return &Service{
+		broker:          broker,
+		exchange:        opts.Exchange,
+		controlExchange: opts.ControlExchange,
+		queues:          opts.Queues,
+		b:               b,
+		fleet:           fleet,
+		escapes:         escapes,
+		CaptureTime:     func() int { return minSeconds + rand.Intn(maxSeconds-minSeconds+1) },
+	}
+}
+
+// Drain refuses new sightings, agents and teams from now on.
+func (s *Service) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Service) Draining() bool {
+	return s.draining.Load()
+}
+
+// Shutdown drains the service. The agents belong to the workers and keep
+// running through an API restart.
+func (s *Service) Shutdown(ctx context.Context) {
+	s.Drain()
+}
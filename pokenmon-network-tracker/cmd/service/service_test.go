@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"pokemonSightingApp/cmd/event"
+	"pokemonSightingApp/cmd/internal/broadcast"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker records published messages and fails the next fail publishes.
+type fakeBroker struct {
+	mu        sync.Mutex
+	published []Message
+	fail      int
+	queues    map[string]QueueStats
+}
+
+func (b *fakeBroker) Publish(ctx context.Context, msgs []Message) []error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	errs := make([]error, len(msgs))
+	for i, m := range msgs {
+		if b.fail > 0 {
+			b.fail--
+			errs[i] = ErrUnavailable
+			continue
+		}
+		b.published = append(b.published, m)
+	}
+	return errs
+}
+
+func (b *fakeBroker) QueueStats(ctx context.Context, name string) (QueueStats, error) {
+	qs, ok := b.queues[name]
+	if !ok {
+		return QueueStats{}, ErrNotFound
+	}
+	return qs, nil
+}
+
+func (b *fakeBroker) PurgeQueues() error { return nil }
+
+func (b *fakeBroker) StartTeam(name string, elements []string, bc broadcast.Broadcaster) (Team, error) {
+	return Team{Name: name, Elements: elements}, nil
+}
+
+type discard struct{}
+
+func (discard) Broadcast(string, string, bool, map[string]any) {}
+
+// newTestService runs against a fake broker and a fleet with one worker of the given capacity.
+func newTestService(capacity int) (*Service, *fakeBroker, *event.Fleet) {
+	broker := &fakeBroker{}
+	fleet := event.NewFleet(time.Minute, 2*time.Minute)
+	if capacity > 0 {
+		fleet.Update(event.WorkerInfo{Id: "worker-1", Capacity: capacity})
+	}
+	s := New(broker, discard{}, fleet, &event.EscapeCounter{}, Options{
+		Exchange:        "pokemon_exchange",
+		ControlExchange: "agent_control",
+		MinCaptureTime:  5 * time.Second,
+		MaxCaptureTime:  5 * time.Second,
+	})
+	return s, broker, fleet
+}
+
+func TestReportSighting(t *testing.T) {
+	s, broker, _ := newTestService(1)
+	sighting := event.Sighting{Pokemon: "Charmander", Location: "Route 24", Element: "fire", Reporter: "red"}
+
+	published, err := s.ReportSighting(context.Background(), sighting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published.CaptureTime != 5 || published.SubmittedAt.IsZero() {
+		t.Errorf("published %+v", published)
+	}
+	if len(broker.published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(broker.published))
+	}
+	m := broker.published[0]
+	if m.Exchange != "pokemon_exchange" || m.RoutingKey != "pokemon.sighting.fire" {
+		t.Errorf("published to %s %s", m.Exchange, m.RoutingKey)
+	}
+	var body event.QueueSighting
+	if err := json.Unmarshal(m.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Sighting != sighting || body.CaptureTime != 5 {
+		t.Errorf("body = %+v", body)
+	}
+}
+
+func TestReportSightingErrors(t *testing.T) {
+	valid := event.Sighting{Pokemon: "Charmander", Location: "Route 24", Element: "fire"}
+	for _, tc := range []struct {
+		name     string
+		sighting event.Sighting
+		prepare  func(*Service, *fakeBroker)
+		want     error
+	}{
+		{"missing pokemon", event.Sighting{Location: "Route 24", Element: "fire"}, nil, ErrInvalid},
+		{"unknown element", event.Sighting{Pokemon: "Pikachu", Location: "Route 24", Element: "electric"}, nil, ErrInvalid},
+		{"draining", valid, func(s *Service, _ *fakeBroker) { s.Drain() }, ErrDraining},
+		{"broker down", valid, func(_ *Service, b *fakeBroker) { b.fail = 1 }, ErrUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, broker, _ := newTestService(1)
+			if tc.prepare != nil {
+				tc.prepare(s, broker)
+			}
+			if _, err := s.ReportSighting(context.Background(), tc.sighting); !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+			if len(broker.published) != 0 {
+				t.Errorf("published %d messages", len(broker.published))
+			}
+		})
+	}
+}
+
+func TestReportSightingsPublishesTheValidOnes(t *testing.T) {
+	s, broker, _ := newTestService(1)
+	_, errs := s.ReportSightings(context.Background(), []event.Sighting{
+		{Pokemon: "Charmander", Location: "Route 24", Element: "fire"},
+		{Pokemon: "", Location: "Route 24", Element: "fire"},
+		{Pokemon: "Squirtle", Location: "Vermilion City", Element: "water"},
+	})
+	if errs[0] != nil || !errors.Is(errs[1], ErrInvalid) || errs[2] != nil {
+		t.Errorf("errs = %v", errs)
+	}
+	if len(broker.published) != 2 || broker.published[1].RoutingKey != "pokemon.sighting.water" {
+		t.Errorf("published %+v", broker.published)
+	}
+}
+
+func TestSpawnAgent(t *testing.T) {
+	s, broker, _ := newTestService(1)
+	agent, err := s.SpawnAgent(context.Background(), "Jessie", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.Id == 0 || agent.Name != "Jessie" || agent.ImageNum != 3 {
+		t.Errorf("agent = %+v", agent)
+	}
+	if len(broker.published) != 1 {
+		t.Fatalf("published %d commands, want 1", len(broker.published))
+	}
+	m := broker.published[0]
+	if m.Exchange != "agent_control" || m.RoutingKey != event.SpawnKey {
+		t.Errorf("published to %s %s", m.Exchange, m.RoutingKey)
+	}
+	var body event.AgentInfo
+	if err := json.Unmarshal(m.Body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body != agent {
+		t.Errorf("command = %+v, want %+v", body, agent)
+	}
+}
+
+func TestSpawnAgentErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		capacity int
+		agent    string
+		imageNum int
+		prepare  func(*Service, *fakeBroker)
+		want     error
+	}{
+		{"missing name", 1, " ", 0, nil, ErrInvalid},
+		{"negative image", 1, "Jessie", -1, nil, ErrInvalid},
+		{"no workers", 0, "Jessie", 0, nil, ErrNoCapacity},
+		{"draining", 1, "Jessie", 0, func(s *Service, _ *fakeBroker) { s.Drain() }, ErrDraining},
+		{"broker down", 1, "Jessie", 0, func(_ *Service, b *fakeBroker) { b.fail = 1 }, ErrUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, broker, _ := newTestService(tc.capacity)
+			if tc.prepare != nil {
+				tc.prepare(s, broker)
+			}
+			if _, err := s.SpawnAgent(context.Background(), tc.agent, tc.imageNum); !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+			if len(broker.published) != 0 {
+				t.Errorf("published %d commands", len(broker.published))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"pokemonSightingApp/cmd/event"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ValidateSighting checks the required fields and the element.
+func ValidateSighting(s event.Sighting) error {
+	var v ValidationError
+	if strings.TrimSpace(s.Pokemon) == "" {
+		v.add("pokemon", "is required")
+	}
+	if strings.TrimSpace(s.Location) == "" {
+		v.add("location", "is required")
+	}
+	if s.Element == "" {
+		v.add("element", "is required")
+	} else if !slices.Contains(event.Elements, s.Element) {
+		v.add("element", fmt.Sprintf("must be one of %s", strings.Join(event.Elements, ", ")))
+	}
+	return v.err()
+}
+
+// ReportSighting validates and publishes a single sighting.
+func (s *Service) ReportSighting(ctx context.Context, sighting event.Sighting) (event.QueueSighting, error) {
+	published, errs := s.ReportSightings(ctx, []event.Sighting{sighting})
+	return published[0], errs[0]
+}
+
+// ReportSightings validates and publishes a batch of sightings. The returned
+// slices line up with the input; an entry's error is nil once it was confirmed.
+func (s *Service) ReportSightings(ctx context.Context, sightings []event.Sighting) ([]event.QueueSighting, []error) {
+	published := make([]event.QueueSighting, len(sightings))
+	errs := make([]error, len(sightings))
+
+	var msgs []Message
+	var index []int
+	for i, sighting := range sightings {
+		published[i].Sighting = sighting
+		if err := ValidateSighting(sighting); err != nil {
+			errs[i] = err
+			continue
+		}
+		if s.Draining() {
+			errs[i] = ErrDraining
+			continue
+		}
+
+		published[i].CaptureTime = s.CaptureTime()
+		published[i].SubmittedAt = time.Now()
+		body, err := json.Marshal(published[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("failed to marshal sighting: %w", err)
+			continue
+		}
+
+		msg := fmt.Sprintf("Spawned %s pokemon: %s at % s with capture time %d", sighting.Element, sighting.Pokemon, sighting.Location, published[i].CaptureTime)
+		s.b.Broadcast(msg, "system log", true, nil)
+
+		msgs = append(msgs, Message{
+			Exchange:   s.exchange,
+			RoutingKey: fmt.Sprintf("pokemon.sighting.%s", sighting.Element),
+			Body:       body,
+		})
+		index = append(index, i)
+	}
+
+	if len(msgs) == 0 {
+		return published, errs
+	}
+	for j, err := range s.broker.Publish(ctx, msgs) {
+		errs[index[j]] = err
+	}
+	return published, errs
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"pokemonSightingApp/cmd/event"
+	"slices"
+	"strings"
+)
+
+// SpawnTeam starts a sighting team listening to its elements.
+func (s *Service) SpawnTeam(ctx context.Context, name string, elements []string) (Team, error) {
+	var v ValidationError
+	if strings.TrimSpace(name) == "" {
+		v.add("name", "is required")
+	}
+	if len(elements) == 0 {
+		v.add("elements", "at least one element is required")
+	}
+	for i, e := range elements {
+		if !slices.Contains(event.Elements, e) {
+			v.add(fmt.Sprintf("elements[%d]", i), fmt.Sprintf("must be one of %s", strings.Join(event.Elements, ", ")))
+		}
+	}
+	if err := v.err(); err != nil {
+		return Team{Name: name, Elements: elements}, err
+	}
+	if s.Draining() {
+		return Team{Name: name, Elements: elements}, ErrDraining
+	}
+
+	return s.broker.StartTeam(name, elements, s.b)
+}